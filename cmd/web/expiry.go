@@ -0,0 +1,92 @@
+package main
+
+import (
+	"time"
+
+	"github.com/andrewwphillips/snippetbox/pkg/forms"
+	"github.com/andrewwphillips/snippetbox/pkg/models"
+)
+
+// expiry is one of the choices (see expiryOptions) of when a new snippet is deleted
+type expiry struct {
+	Value string // the "expires" form value - a duration (see forms.ParseDuration), expiresNever or expiresCustom
+	Label string // displayed to users, eg "One Week"
+}
+
+// Special values of the "expires" field of the create form (see validateExpiry)
+const (
+	expiresNever  = "never"  // the snippet is never deleted (unless there is a maximum expiry)
+	expiresCustom = "custom" // the snippet is deleted at the time given in the "expires_at" field
+)
+
+// expiresAtLayout is the format of the "expires_at" field (an HTML datetime-local input) which is taken as UTC
+const expiresAtLayout = "2006-01-02T15:04"
+
+// minExpiry is the shortest time a snippet can be kept
+const minExpiry = time.Minute
+
+// expiries are the durations that can be chosen (in the order they are listed), shortest first.  Any
+// other duration can also be used (eg "90m") but is not listed in the form.
+var expiries = []expiry{
+	{"10m", "Ten Minutes"},
+	{"1h", "One Hour"},
+	{"1d", "One Day"},
+	{"7d", "One Week"},
+	{"365d", "One Year"},
+}
+
+// expiryOptions returns the choices of when a new snippet is deleted - the durations in expiries that are
+// allowed (see app.maxExpiry) then "never" (if there is no maximum) and "custom"
+func (app *application) expiryOptions() []expiry {
+	var options []expiry
+	for _, e := range expiries {
+		if d, _ := forms.ParseDuration(e.Value); app.maxExpiry == 0 || d <= app.maxExpiry {
+			options = append(options, e)
+		}
+	}
+	if app.maxExpiry == 0 {
+		options = append(options, expiry{expiresNever, "Never"})
+	}
+	return append(options, expiry{expiresCustom, "At (UTC):"})
+}
+
+// defaultExpiry returns the choice of when a new snippet is deleted that is selected to start with -
+// the longest allowed duration (see expiryOptions), eg a year
+func (app *application) defaultExpiry() string {
+	options := app.expiryOptions()
+	for i := len(options) - 1; i >= 0; i-- {
+		if v := options[i].Value; v != expiresNever && v != expiresCustom {
+			return v
+		}
+	}
+	return expiresCustom // the maximum is shorter than all the listed durations
+}
+
+// validateExpiry checks the "expires" field of the create form which is a duration (eg "10m" or "7d"),
+// expiresNever or expiresCustom with the time in the "expires_at" field
+func (app *application) validateExpiry(form *forms.Form) {
+	switch form.Get("expires") {
+	case expiresNever:
+		if app.maxExpiry != 0 {
+			form.Errors.Add("expires", "This field is invalid")
+		}
+	case expiresCustom:
+		form.Required("expires_at")
+		form.ValidFutureTime("expires_at", expiresAtLayout, minExpiry, app.maxExpiry)
+	default:
+		form.ValidDuration("expires", minExpiry, app.maxExpiry)
+	}
+}
+
+// formExpires returns when a snippet is to be deleted from the (validated) create form
+func formExpires(form *forms.Form) time.Time {
+	switch form.Get("expires") {
+	case expiresNever:
+		return models.Never
+	case expiresCustom:
+		t, _ := time.ParseInLocation(expiresAtLayout, form.Get("expires_at"), time.UTC)
+		return t
+	}
+	d, _ := forms.ParseDuration(form.Get("expires"))
+	return time.Now().UTC().Add(d)
+}
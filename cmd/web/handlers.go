@@ -3,13 +3,17 @@ package main
 import (
 	"fmt"
 	"net/http"
+	"net/url"
 	"strconv"
+	"strings"
 
+	"github.com/andrewwphillips/snippetbox/pkg/diff"
 	"github.com/andrewwphillips/snippetbox/pkg/forms"
 	"github.com/andrewwphillips/snippetbox/pkg/models"
 )
 
-// home shows the default page - list of the latest snippets (see home.page.html)
+// home shows the default page - list of the latest snippets (see home.page.html).  It also
+// shows older (/snippets?before=...) and newer (/snippets?after=...) pages - see snippetPage.
 func (app *application) home(w http.ResponseWriter, r *http.Request) {
 	// This is not nec. when we moved from the std lib router to pat since (unlike other patterns
 	// ending in a slash) "/" only matches itself
@@ -18,9 +22,8 @@ func (app *application) home(w http.ResponseWriter, r *http.Request) {
 	//	return
 	//}
 
-	ss, err := app.snippets.Latest()
-	if err != nil {
-		app.serverError(w, err)
+	td := app.snippetPage(w, r, "/snippets?", app.snippets.Page)
+	if td == nil {
 		return
 	}
 
@@ -46,25 +49,34 @@ func (app *application) home(w http.ResponseWriter, r *http.Request) {
 	//  // and this also indirectly calls WriteHeader (http: superfluous response.WriteHeader)
 	//	app.serverError(w, err)
 	//}
-	app.render(w, r, "home.page.tmpl", &templateData{Snippets: ss})
+	app.render(w, r, "home.page.tmpl", td)
+}
+
+// searchSnippets displays the "search" page listing the snippets that match the "q" query parameter
+// (see models.SearchTerms).  Like the home page the results are shown a page at a time.
+func (app *application) searchSnippets(w http.ResponseWriter, r *http.Request) {
+	q := strings.TrimSpace(r.URL.Query().Get("q"))
+	td := &templateData{}
+	if q != "" {
+		td = app.snippetPage(w, r, "/search?q="+url.QueryEscape(q)+"&", func(cursor models.Cursor, limit int) ([]*models.Snippet, error) {
+			return app.snippets.Search(q, cursor, limit)
+		})
+		if td == nil {
+			return
+		}
+	}
+	td.Query = q
+
+	app.render(w, r, "search.page.tmpl", td)
 }
 
 // showSnippet displays the "show" page to view a single snippet
 func (app *application) showSnippet(w http.ResponseWriter, r *http.Request) {
 	//id, err := strconv.Atoi(r.URL.Query().Get("id")) // get "id" query param.
-	id, err := strconv.Atoi(r.URL.Query().Get(":id")) // now using pat's named capture (part of the URL) not query parameter
-	if err != nil || id < 1 {
-		app.notFound(w) // not a number or -ve/zero
-		return
-	}
-
-	s, err2 := app.snippets.Get(id)
-	if err2 != nil {
-		app.serverError(w, err)
-		return
-	}
+	//id, err := strconv.Atoi(r.URL.Query().Get(":id")) // now using pat's named capture (part of the URL) not query parameter
+	// Now using a random slug (not the sequential ID) so that snippets can't be found by counting
+	s := app.findSnippet(w, r)
 	if s == nil {
-		app.notFound(w) // not an actual snippet number
 		return
 	}
 
@@ -88,14 +100,93 @@ func (app *application) showSnippet(w http.ResponseWriter, r *http.Request) {
 	//	app.serverError(w, err)
 	//}
 
-	app.render(w, r, "show.page.tmpl", &templateData{Snippet: s})
+	// Ask for the password of a protected snippet (before it can be burned)
+	if !app.unlocked(r, s) {
+		app.render(w, r, "unlock.page.tmpl", &templateData{Snippet: s, Form: forms.New(nil)})
+		return
+	}
+
+	// Get the tags before the snippet is (possibly) burned as that deletes them too
+	tags, err3 := app.snippets.Tags(s.ID)
+	if err3 != nil {
+		app.serverError(w, err3)
+		return
+	}
+	if s = app.burnSnippet(w, r, s); s == nil {
+		return
+	}
+
+	app.render(w, r, "show.page.tmpl", &templateData{Snippet: s, Tags: tags})
 }
 
+// unlockSnippet is a POST method that responds to submission of the password of a protected snippet
+// (see showSnippet).  If the password is right the snippet is unlocked for the rest of the session.
+func (app *application) unlockSnippet(w http.ResponseWriter, r *http.Request) {
+	s := app.findSnippet(w, r)
+	if s == nil {
+		return
+	}
+	if err := r.ParseForm(); err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	form := forms.New(r.PostForm)
+	form.Required("password")
+	if !form.Valid() {
+		app.render(w, r, "unlock.page.tmpl", &templateData{Snippet: s, Form: form})
+		return
+	}
+
+	err := app.snippets.Unlock(s.ID, form.Get("password"))
+	if err == models.ErrInvalidCredentials {
+		form.Errors.Add("password", "Incorrect password")
+		app.render(w, r, "unlock.page.tmpl", &templateData{Snippet: s, Form: form})
+		return
+	} else if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	app.addUnlocked(r, s.ID)
+	http.Redirect(w, r, snippetURL(s.Slug), http.StatusSeeOther)
+}
+
+// redirectSnippet redirects old links (/snippet/:id) to the page of the snippet (/s/:slug), which
+// checks whether it needs a password or is burned after reading.  This works for unlisted snippets
+// so that links shared before slugs were added still work, but not for someone else's private one.
+func (app *application) redirectSnippet(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(r.URL.Query().Get(":id"))
+	if err != nil || id < 1 {
+		app.notFound(w)
+		return
+	}
+
+	s, err2 := app.snippets.Get(id)
+	if err2 != nil {
+		app.serverError(w, err2)
+		return
+	}
+	if s == nil || !s.VisibleTo(app.userID(r)) {
+		app.notFound(w)
+		return
+	}
+
+	http.Redirect(w, r, snippetURL(s.Slug), http.StatusMovedPermanently)
+}
+
+const (
+	maxTags      = 5  // most tags a snippet can have
+	maxTagLength = 30 // longest tag (the size of the tags.name column)
+)
+
 // createSnippetForm displays a form to the user that allows them to create a new snippet
 func (app *application) createSnippetForm(w http.ResponseWriter, r *http.Request) {
 	// We now need to send an empty Form so that the HTML form (between {{with .Form}} ... {{end}} is shown
 	//app.render(w, r, "create.page.tmpl", nil)
-	app.render(w, r, "create.page.tmpl", &templateData{Form: forms.New(nil)})
+	// By default, the language of the snippet is detected from its content
+	form := forms.New(url.Values{"language": {"auto"}, "expires": {app.defaultExpiry()}})
+	app.render(w, r, "create.page.tmpl", &templateData{Form: form, Expiries: app.expiryOptions()})
 }
 
 // createSnippet is a POST method that responds to the submission of the create snippet form
@@ -155,27 +246,229 @@ func (app *application) createSnippet(w http.ResponseWriter, r *http.Request) {
 	form := forms.New(r.PostForm)
 	form.Required("title", "content", "expires")
 	form.MaxLength("title", 100)
-	form.PermittedValues("expires", "365", "7", "1")
+	app.validateExpiry(form)
+	form.PermittedValues("language", append(languageNames(), "auto")...)
+	form.PermittedValues("visibility", models.Public, models.Unlisted, models.Private)
+	form.PermittedValues("burn", "true")
+	form.MinLength("password", 8)
+	form.MaxLength("password", 72) // bcrypt ignores the rest
+	form.ValidTags("tags", maxTags, maxTagLength)
 	if !form.Valid() {
-		app.render(w, r, "create.page.tmpl", &templateData{Form: form})
+		app.render(w, r, "create.page.tmpl", &templateData{Form: form, Expiries: app.expiryOptions()})
 		return
 	}
 
-	// Add a snippet using the (now validated) form fields
-	id, err := app.snippets.Insert(form.Get("title"), form.Get("content"), form.Get("expires"))
+	// Add a snippet using the (now validated) form fields, recording who created it
+	userID := app.authenticatedUser(r).ID
+	id, slug, err := app.snippets.Insert(userID, form.Get("title"), form.Get("content"), formLanguage(form),
+		formVisibility(form), formExpires(form), form.Get("password"), form.Get("burn") == "true")
 	if err != nil {
 		app.serverError(w, err)
 		return
 	}
+	if tags := form.Tags("tags"); len(tags) > 0 {
+		if err = app.snippets.SetTags(id, tags); err != nil {
+			app.serverError(w, err)
+			return
+		}
+	}
 
 	// Add a "flash" message to be displayed later
 	app.session.Put(r, "flash", "Snippet successfully created!")
 
 	// Redirect the user to a page showing the new snippet
 	//http.Redirect(w, r, fmt.Sprintf("/snippet?id=%d", id), http.StatusSeeOther)
-	http.Redirect(w, r, fmt.Sprintf("/snippet/%d", id), http.StatusSeeOther) // id value => ":id"
+	//http.Redirect(w, r, fmt.Sprintf("/snippet/%d", id), http.StatusSeeOther) // id value => ":id"
+	http.Redirect(w, r, snippetURL(slug), http.StatusSeeOther)
+}
+
+// editSnippetForm displays a form allowing the owner of a snippet to change it
+func (app *application) editSnippetForm(w http.ResponseWriter, r *http.Request) {
+	s := app.ownedSnippet(r)
+	tags, err := app.snippets.Tags(s.ID)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	// Fill in the form fields with the current values
+	form := forms.New(url.Values{})
+	form.Set("title", s.Title)
+	form.Set("content", s.Content)
+	form.Set("language", s.Language)
+	form.Set("visibility", s.Visibility)
+	form.Set("tags", strings.Join(tags, " "))
+	app.render(w, r, "edit.page.tmpl", &templateData{Form: form, Snippet: s})
+}
+
+// editSnippet is a POST method that responds to the submission of the edit snippet form
+func (app *application) editSnippet(w http.ResponseWriter, r *http.Request) {
+	s := app.ownedSnippet(r)
+
+	r.Body = http.MaxBytesReader(w, r.Body, 32768) // limit to 32K
+	if err := r.ParseForm(); err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	// Validate the form fields (the same as when created but the expiry can't be changed)
+	form := forms.New(r.PostForm)
+	form.Required("title", "content")
+	form.MaxLength("title", 100)
+	form.PermittedValues("language", append(languageNames(), "auto")...)
+	form.PermittedValues("visibility", models.Public, models.Unlisted, models.Private)
+	form.ValidTags("tags", maxTags, maxTagLength)
+	if !form.Valid() {
+		app.render(w, r, "edit.page.tmpl", &templateData{Form: form, Snippet: s})
+		return
+	}
+
+	if err := app.snippets.Update(s.ID, form.Get("title"), form.Get("content"), formLanguage(form), formVisibility(form)); err != nil {
+		app.serverError(w, err)
+		return
+	}
+	if err := app.snippets.SetTags(s.ID, form.Tags("tags")); err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	app.session.Put(r, "flash", "Snippet successfully updated!")
+	http.Redirect(w, r, snippetURL(s.Slug), http.StatusSeeOther)
+}
+
+// deleteSnippet is a POST method that removes a snippet (from the delete button on the show page)
+func (app *application) deleteSnippet(w http.ResponseWriter, r *http.Request) {
+	if err := app.snippets.Delete(app.ownedSnippet(r).ID); err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	app.session.Put(r, "flash", "Snippet deleted.")
+	http.Redirect(w, r, "/user/snippets", http.StatusSeeOther)
+}
+
+// userSnippets displays the "My snippets" page listing all snippets created by the current user
+func (app *application) userSnippets(w http.ResponseWriter, r *http.Request) {
+	ss, err := app.snippets.ByUser(app.authenticatedUser(r).ID)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	app.render(w, r, "mysnippets.page.tmpl", &templateData{Snippets: ss})
+}
+
+// tagSnippets displays the "tag" page listing the snippets with the tag given by ":name" in the URL.
+// Like the home page the snippets are shown a page at a time.
+func (app *application) tagSnippets(w http.ResponseWriter, r *http.Request) {
+	tag := r.URL.Query().Get(":name")
+	if !forms.TagRX.MatchString(tag) {
+		app.notFound(w)
+		return
+	}
+
+	td := app.snippetPage(w, r, tagURL(tag)+"?", func(cursor models.Cursor, limit int) ([]*models.Snippet, error) {
+		return app.snippets.ByTag(tag, cursor, limit)
+	})
+	if td == nil {
+		return
+	}
+	td.Tag = tag
+
+	app.render(w, r, "tag.page.tmpl", td)
+}
+
+// snippetHistory displays the "history" page listing all the revisions of a snippet
+func (app *application) snippetHistory(w http.ResponseWriter, r *http.Request) {
+	s := app.urlSnippet(w, r)
+	if s == nil {
+		return
+	}
+
+	revisions, err := app.snippets.Revisions(s.ID)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	app.render(w, r, "history.page.tmpl", &templateData{Snippet: s, Revisions: revisions})
+}
+
+// snippetDiff displays the differences between two revisions of a snippet given by the "from"
+// and "to" query parameters.  By default, it compares the latest revision with the one before.
+func (app *application) snippetDiff(w http.ResponseWriter, r *http.Request) {
+	s := app.urlSnippet(w, r)
+	if s == nil {
+		return
+	}
+
+	// Get the revision numbers to compare, using the defaults (which need the latest revision) if not given
+	q := r.URL.Query()
+	var from, to int
+	if q.Get("from") == "" || q.Get("to") == "" {
+		revisions, err := app.snippets.Revisions(s.ID)
+		if err != nil {
+			app.serverError(w, err)
+			return
+		}
+		if len(revisions) == 0 {
+			app.notFound(w)
+			return
+		}
+		to, from = revisions[0].Number, revisions[0].Number-1
+		if len(revisions) == 1 {
+			from = to
+		}
+	}
+	var err error
+	if v := q.Get("to"); v != "" {
+		if to, err = strconv.Atoi(v); err != nil {
+			app.clientError(w, http.StatusBadRequest)
+			return
+		}
+	}
+	if v := q.Get("from"); v != "" {
+		if from, err = strconv.Atoi(v); err != nil {
+			app.clientError(w, http.StatusBadRequest)
+			return
+		}
+	}
+
+	td := &templateData{Snippet: s}
+	if td.From, err = app.snippets.Revision(s.ID, from); err != nil {
+		app.serverError(w, err)
+		return
+	}
+	if td.To, err = app.snippets.Revision(s.ID, to); err != nil {
+		app.serverError(w, err)
+		return
+	}
+	if td.From == nil || td.To == nil {
+		app.notFound(w) // no such revision
+		return
+	}
+	td.Hunks = diff.Unified(td.From.Content, td.To.Content, 3)
+
+	app.render(w, r, "diff.page.tmpl", td)
+}
+
+// rawSnippet sends the content of a snippet as plain text (so that whitespace is preserved)
+func (app *application) rawSnippet(w http.ResponseWriter, r *http.Request) {
+	if s := app.burnSnippet(w, r, app.unlockedSnippet(w, r)); s != nil {
+		serveSnippetContent(w, r, s, "inline")
+	}
+}
+
+// downloadSnippet is like rawSnippet but tells the browser to save the content to a file
+func (app *application) downloadSnippet(w http.ResponseWriter, r *http.Request) {
+	if s := app.burnSnippet(w, r, app.unlockedSnippet(w, r)); s != nil {
+		serveSnippetContent(w, r, s, "attachment")
+	}
 }
 
+// minPasswordLength is the shortest password a user can choose (when signing up or resetting it)
+const minPasswordLength = 10
+
 // signupUserForm displays a form to the user allowing them to create a login
 func (app *application) signupUserForm(w http.ResponseWriter, r *http.Request) {
 	app.render(w, r, "signup.page.tmpl", &templateData{Form: forms.New(nil)})
@@ -193,7 +486,7 @@ func (app *application) signupUser(w http.ResponseWriter, r *http.Request) {
 	form := forms.New(r.PostForm)
 	form.Required("name", "email", "password")
 	form.MatchesPattern("email", forms.EmailRX)
-	form.MinLength("password", 10)
+	form.MinLength("password", minPasswordLength)
 	if !form.Valid() {
 		app.render(w, r, "signup.page.tmpl", &templateData{Form: form})
 		return
@@ -209,13 +502,17 @@ func (app *application) signupUser(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	_ = id // TODO use id to automatically login
-
-	// Add a "flash" message to be displayed in the next page
-	app.session.Put(r, "flash", "Your signup was successful. Please log in.")
-
-	// And redirect the user to the login page.
-	http.Redirect(w, r, "/user/login", http.StatusSeeOther)
+	// Log in the new user and send them to the page they were trying to reach (or home).  They can't
+	// create snippets until they open the link in the email we send them (see verifyUser).
+	user := &models.User{ID: id, Name: form.Get("name"), Email: form.Get("email")}
+	next := app.startSession(r, user)
+	flash := "Your signup was successful. Welcome " + user.Name + ". Please check your email to verify your address."
+	if err := app.sendVerifyEmail(user); err != nil {
+		app.errorLog.Println("verify email:", err)
+		flash = "Your signup was successful. Welcome " + user.Name + ". We couldn't send you an email to verify your address - please try again later."
+	}
+	app.session.Put(r, "flash", flash)
+	http.Redirect(w, r, next, http.StatusSeeOther)
 }
 
 // loginUserForm displays a form allowing a user to login
@@ -235,13 +532,13 @@ func (app *application) loginUser(w http.ResponseWriter, r *http.Request) {
 	form := forms.New(r.PostForm)
 	form.Required("email", "password")
 	form.MatchesPattern("email", forms.EmailRX)
-	form.MinLength("password", 10)
+	form.MinLength("password", minPasswordLength)
 	if !form.Valid() {
 		app.render(w, r, "login.page.tmpl", &templateData{Form: form})
 		return
 	}
 
-	id, name, err2 := app.users.Authenticate(form.Get("email"), form.Get("password"))
+	id, _, err2 := app.users.Authenticate(form.Get("email"), form.Get("password"))
 	if err2 == models.ErrInvalidCredentials {
 		form.Errors.Add("generic", "Invalid email or password")
 		app.render(w, r, "login.page.tmpl", &templateData{Form: form})
@@ -251,10 +548,241 @@ func (app *application) loginUser(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Login successful so add the ID to the session and display a message
-	app.session.Put(r, sessionUserID, id)
-	app.session.Put(r, "flash", "Hello "+name)
-	http.Redirect(w, r, "/", http.StatusSeeOther) // home
+	user, err3 := app.users.Get(id)
+	if err3 != nil || user == nil {
+		app.serverError(w, fmt.Errorf("user %d not found after login: %v", id, err3))
+		return
+	}
+
+	// Login successful so add the user to the (new) session, display a message and send the user back
+	// to the page they were trying to reach (or home)
+	next := app.startSession(r, user)
+	app.session.Put(r, "flash", "Hello "+user.Name)
+	http.Redirect(w, r, next, http.StatusSeeOther)
+}
+
+// verifyUser is opened from the link in a verification email (see sendVerifyEmail) and marks the
+// user's email address as verified
+func (app *application) verifyUser(w http.ResponseWriter, r *http.Request) {
+	_, err := app.users.Verify(r.URL.Query().Get(":token"))
+	if err == models.ErrInvalidToken {
+		app.session.Put(r, "flash", "That verification link is invalid or has expired.")
+		http.Redirect(w, r, "/", http.StatusSeeOther)
+		return
+	} else if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	app.session.Put(r, "flash", "Thank you - your email address has been verified.")
+	http.Redirect(w, r, "/", http.StatusSeeOther)
+}
+
+// resendVerifyEmail is a POST method that sends the current user another verification email (eg
+// if they lost the first one or it expired)
+func (app *application) resendVerifyEmail(w http.ResponseWriter, r *http.Request) {
+	user := app.authenticatedUser(r)
+	if user.Verified {
+		app.session.Put(r, "flash", "Your email address is already verified.")
+		http.Redirect(w, r, "/", http.StatusSeeOther)
+		return
+	}
+	if err := app.sendVerifyEmail(user); err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	app.session.Put(r, "flash", "We have sent another verification email to "+user.Email)
+	http.Redirect(w, r, "/", http.StatusSeeOther)
+}
+
+// forgotPasswordForm displays a form asking for the email address of a user who has forgotten their password
+func (app *application) forgotPasswordForm(w http.ResponseWriter, r *http.Request) {
+	app.render(w, r, "forgot.page.tmpl", &templateData{Form: forms.New(nil)})
+}
+
+// forgotPassword is a POST method that responds to submission of the forgot password form by emailing
+// a link to reset the password (see resetPasswordForm).  So that the form can't be used to find out
+// who has signed up, the response is the same whether or not there is a user with the email address.
+func (app *application) forgotPassword(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	form := forms.New(r.PostForm)
+	form.Required("email")
+	form.MatchesPattern("email", forms.EmailRX)
+	if !form.Valid() {
+		app.render(w, r, "forgot.page.tmpl", &templateData{Form: form})
+		return
+	}
+
+	user, err := app.users.GetByEmail(form.Get("email"))
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+	if user != nil {
+		// An error is only logged so that the response is still the same as for an unknown address
+		if err = app.sendResetEmail(user); err != nil {
+			app.errorLog.Println("reset email:", err)
+		}
+	}
+
+	app.session.Put(r, "flash", "If "+form.Get("email")+" has signed up we have sent it a link to reset the password.")
+	http.Redirect(w, r, "/user/login", http.StatusSeeOther)
+}
+
+// resetPasswordForm is opened from the link in a password reset email (see sendResetEmail) and displays
+// a form for the new password.  The token is checked when the form is submitted (see resetPassword).
+func (app *application) resetPasswordForm(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Referrer-Policy", "no-referrer") // don't leak the token to other sites (eg fonts)
+	app.render(w, r, "reset.page.tmpl", &templateData{Form: forms.New(nil), Token: r.URL.Query().Get(":token")})
+}
+
+// resetPassword is a POST method that responds to submission of the reset password form.  The user is
+// logged out everywhere (see authenticate) and must log in with the new password.
+func (app *application) resetPassword(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+	token := r.URL.Query().Get(":token")
+
+	// The rules for the new password are the same as when signing up
+	form := forms.New(r.PostForm)
+	form.Required("password")
+	form.MinLength("password", minPasswordLength)
+	if !form.Valid() {
+		app.render(w, r, "reset.page.tmpl", &templateData{Form: form, Token: token})
+		return
+	}
+
+	_, err := app.users.ResetPassword(token, form.Get("password"))
+	if err == models.ErrInvalidToken {
+		app.session.Put(r, "flash", "That password reset link is invalid or has expired. Please ask for another.")
+		http.Redirect(w, r, "/user/forgot", http.StatusSeeOther)
+		return
+	} else if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	// Nobody is logged in with this session now (see authenticate) but remove the user anyway in case it
+	// was someone else's session
+	app.session.Remove(r, sessionUserID)
+	app.session.Put(r, "flash", "Your password has been reset. Please log in with your new password.")
+	http.Redirect(w, r, "/user/login", http.StatusSeeOther)
+}
+
+// userProfile displays the current user's account details with forms to change them
+func (app *application) userProfile(w http.ResponseWriter, r *http.Request) {
+	app.renderProfile(w, r, forms.New(url.Values{}))
+}
+
+// updateName is a POST method that responds to submission of the change name form of the profile page
+func (app *application) updateName(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	form := forms.New(r.PostForm)
+	form.Required("name")
+	if !form.Valid() {
+		app.renderProfile(w, r, form)
+		return
+	}
+
+	if err := app.users.UpdateName(app.userID(r), form.Get("name")); err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	app.session.Put(r, "flash", "Your name has been changed.")
+	http.Redirect(w, r, "/user/profile", http.StatusSeeOther)
+}
+
+// updateEmail is a POST method that responds to submission of the change email form of the profile page.
+// The user must verify the new address (see sendVerifyEmail) before they can create snippets again.
+func (app *application) updateEmail(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	form := forms.New(r.PostForm)
+	form.Required("email")
+	form.MatchesPattern("email", forms.EmailRX)
+	if !form.Valid() {
+		app.renderProfile(w, r, form)
+		return
+	}
+	user := app.authenticatedUser(r)
+	if form.Get("email") == user.Email {
+		http.Redirect(w, r, "/user/profile", http.StatusSeeOther) // nothing to do
+		return
+	}
+
+	err := app.users.UpdateEmail(user.ID, form.Get("email"))
+	if err == models.ErrDuplicateEmail {
+		form.Errors.Add("email", "Address is already in use")
+		app.renderProfile(w, r, form)
+		return
+	} else if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	changed := *user
+	changed.Email = form.Get("email")
+	flash := "Your email address has been changed. Please check your email to verify the new address."
+	if err = app.sendVerifyEmail(&changed); err != nil {
+		app.errorLog.Println("verify email:", err)
+		flash = "Your email address has been changed. We couldn't send you an email to verify it - please try again later."
+	}
+	app.session.Put(r, "flash", flash)
+	http.Redirect(w, r, "/user/profile", http.StatusSeeOther)
+}
+
+// changePassword is a POST method that responds to submission of the change password form of the profile
+// page.  The user stays logged in with this session but is logged out of all others (see authenticate).
+func (app *application) changePassword(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	// The rules for the new password are the same as when signing up
+	form := forms.New(r.PostForm)
+	form.Required("current_password", "password")
+	form.MinLength("password", minPasswordLength)
+	if !form.Valid() {
+		app.renderProfile(w, r, form)
+		return
+	}
+
+	id := app.userID(r)
+	err := app.users.ChangePassword(id, form.Get("current_password"), form.Get("password"))
+	if err == models.ErrInvalidCredentials {
+		form.Errors.Add("current_password", "Incorrect password")
+		app.renderProfile(w, r, form)
+		return
+	} else if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	// Keep this session going with the user's new SessionVersion
+	user, err := app.users.Get(id)
+	if err != nil || user == nil {
+		app.serverError(w, fmt.Errorf("user %d not found after changing password: %v", id, err))
+		return
+	}
+	app.session.Put(r, sessionVersion, user.SessionVersion)
+	app.session.Put(r, "flash", "Your password has been changed. You have been logged out everywhere else.")
+	http.Redirect(w, r, "/user/profile", http.StatusSeeOther)
 }
 
 // logoutUser is a POST method that logs out the user
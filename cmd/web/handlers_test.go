@@ -2,12 +2,20 @@ package main
 
 import (
 	"bytes"
+	"errors"
+	"fmt"
+	"html"
 	"io"
 	"net/http"
 	"net/http/httptest"
 	"net/url"
+	"reflect"
+	"regexp"
 	"strings"
 	"testing"
+	"time"
+
+	"github.com/andrewwphillips/snippetbox/pkg/models"
 )
 
 // TestPing is a very simple test of the ping handler
@@ -81,12 +89,123 @@ func TestPingEndToEnd(t *testing.T) {
 	}
 }
 
+// TestHomePages checks that the home page shows the latest snippets with links to older and newer pages
+func TestHomePages(t *testing.T) {
+	app := newTestApplication(t)
+	for i := 2; i <= 25; i++ { // snippet 1 is already there
+		if _, _, err := app.snippets.Insert(1, fmt.Sprintf("Snippet %d", i), "Content", "", models.Public, time.Now().AddDate(0, 0, 1), "", false); err != nil {
+			t.Fatal(err)
+		}
+	}
+	server := newTestServer(t, app.routes(""))
+	defer server.Close()
+
+	// pageLink returns the URL of a link (eg "Older") on a page
+	linkRE := regexp.MustCompile(`href='(/snippets\?[^']+)'[^>]*>([^<]+)<`)
+	pageLink := func(body, text string) string {
+		for _, m := range linkRE.FindAllStringSubmatch(body, -1) {
+			if strings.Contains(m[2], text) {
+				return html.UnescapeString(m[1])
+			}
+		}
+		return ""
+	}
+
+	// Follow the "Older" links to the end (snippet 1) then the "Newer" links back to the start
+	urlPath := "/"
+	for _, step := range []struct {
+		link             string // link to follow to the next page
+		first, last      int    // IDs of the snippets listed
+		hasPrev, hasNext bool
+	}{
+		{"Older", 25, 16, false, true},
+		{"Older", 15, 6, true, true},
+		{"Newer", 5, 1, true, false},
+		{"Newer", 15, 6, true, true},
+		{"", 25, 16, false, true},
+	} {
+		code, _, body := server.get(t, urlPath)
+		if code != http.StatusOK {
+			t.Fatalf("%s: want %d; got %d", urlPath, http.StatusOK, code)
+		}
+		if !strings.Contains(body, fmt.Sprintf("<td>#%d</td>", step.first)) ||
+			!strings.Contains(body, fmt.Sprintf("<td>#%d</td>", step.last)) ||
+			strings.Contains(body, fmt.Sprintf("<td>#%d</td>", step.first+1)) ||
+			strings.Contains(body, fmt.Sprintf("<td>#%d</td>", step.last-1)) {
+			t.Errorf("%s: want snippets #%d to #%d", urlPath, step.first, step.last)
+		}
+		if got := pageLink(body, "Newer") != ""; got != step.hasPrev {
+			t.Errorf("%s: want Newer link %v; got %v", urlPath, step.hasPrev, got)
+		}
+		if got := pageLink(body, "Older") != ""; got != step.hasNext {
+			t.Errorf("%s: want Older link %v; got %v", urlPath, step.hasNext, got)
+		}
+		if step.link != "" {
+			if urlPath = pageLink(body, step.link); urlPath == "" {
+				t.Fatalf("no %s link", step.link)
+			}
+		}
+	}
+
+	if code, _, _ := server.get(t, "/snippets?before=xyz"); code != http.StatusBadRequest {
+		t.Errorf("invalid cursor: want %d; got %d", http.StatusBadRequest, code)
+	}
+}
+
+// TestSearchSnippets checks the search page, including the links to further pages of results
+func TestSearchSnippets(t *testing.T) {
+	app := newTestApplication(t)
+	for i := 2; i <= 12; i++ { // snippet 1 is already there
+		if _, _, err := app.snippets.Insert(1, fmt.Sprintf("Haiku %d", i), "A frog jumps", "", models.Public, time.Now().AddDate(0, 0, 1), "", false); err != nil {
+			t.Fatal(err)
+		}
+	}
+	server := newTestServer(t, app.routes(""))
+	defer server.Close()
+
+	tests := []struct {
+		name     string
+		urlPath  string
+		wantCode int
+		wantBody []string
+		notBody  []string
+	}{
+		{"No query", "/search", http.StatusOK, []string{"Enter some words"}, nil},
+		{"Not found", "/search?q=toad", http.StatusOK, []string{"No snippets found"}, nil},
+		{"Found", "/search?q=Pond", http.StatusOK,
+			[]string{"An old silent <mark>pond</mark>", "#1", "value='Pond'"}, []string{"Haiku", "Older"}},
+		{"First page", "/search?q=frog", http.StatusOK,
+			[]string{"Haiku 12", "Haiku 3", "A <mark>frog</mark> jumps", "/search?q=frog&amp;before="},
+			[]string{"Haiku 2<", "Newer"}},
+		{"Invalid cursor", "/search?q=frog&before=x", http.StatusBadRequest, nil, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			code, _, body := server.get(t, tt.urlPath)
+			if code != tt.wantCode {
+				t.Errorf("want %d; got %d", tt.wantCode, code)
+			}
+			for _, want := range tt.wantBody {
+				if !strings.Contains(body, want) {
+					t.Errorf("want body to contain %q", want)
+				}
+			}
+			for _, notWant := range tt.notBody {
+				if strings.Contains(body, notWant) {
+					t.Errorf("want body not to contain %q", notWant)
+				}
+			}
+		})
+	}
+}
+
 // TestShowSnippet tests different requests for the HTML page to display a snippet
 func TestShowSnippet(t *testing.T) {
 	// Create a mock app and start test server
 	app := newTestApplication(t)
 	server := newTestServer(t, app.routes(""))
 	defer server.Close()
+	path := snippetPath(t, app, 1)
 
 	tests := []struct {
 		name     string
@@ -94,13 +213,12 @@ func TestShowSnippet(t *testing.T) {
 		wantCode int
 		wantBody string
 	}{
-		{"Valid ID", "/snippet/1", http.StatusOK, "An old silent pond..."},
-		{"Non-existent ID", "/snippet/2", http.StatusNotFound, http.StatusText(http.StatusNotFound)},
-		{"Negative ID", "/snippet/-1", http.StatusNotFound, http.StatusText(http.StatusNotFound)},
-		{"Decimal ID", "/snippet/1.23", http.StatusNotFound, http.StatusText(http.StatusNotFound)},
-		{"String ID", "/snippet/foo", http.StatusNotFound, http.StatusText(http.StatusNotFound)},
-		{"Empty ID", "/snippet/", http.StatusNotFound, "not found"},
-		{"Trailing slash", "/snippet/1/", http.StatusNotFound, "not found"},
+		{"Valid slug", path, http.StatusOK, "An old silent pond..."},
+		{"Author", path, http.StatusOK, "by Alice"},
+		{"Non-existent slug", "/s/AAAAAAAAAAAA", http.StatusNotFound, http.StatusText(http.StatusNotFound)},
+		{"ID not slug", "/s/1", http.StatusNotFound, http.StatusText(http.StatusNotFound)},
+		{"Empty slug", "/s/", http.StatusNotFound, "not found"},
+		{"Trailing slash", path + "/", http.StatusNotFound, "not found"},
 	}
 
 	for _, tt := range tests {
@@ -121,6 +239,251 @@ func TestShowSnippet(t *testing.T) {
 	}
 }
 
+// TestRedirectSnippet checks that old links to snippets (using the ID) are redirected to the
+// snippet's page, including unlisted snippets but not someone else's private snippet
+func TestRedirectSnippet(t *testing.T) {
+	app := newTestApplication(t)
+	for _, visibility := range []string{models.Unlisted, models.Private} {
+		if _, _, err := app.snippets.Insert(1, visibility, "Content", "", visibility, time.Now().AddDate(0, 0, 1), "", false); err != nil {
+			t.Fatal(err)
+		}
+	}
+	server := newTestServer(t, app.routes(""))
+	defer server.Close()
+
+	tests := []struct {
+		name         string
+		email        string // who is logged in (if anyone)
+		urlPath      string
+		wantCode     int
+		wantLocation string
+	}{
+		{"Public", "", "/snippet/1", http.StatusMovedPermanently, snippetPath(t, app, 1)},
+		{"Unlisted", "", "/snippet/2", http.StatusMovedPermanently, snippetPath(t, app, 2)},
+		{"Private", "", "/snippet/3", http.StatusNotFound, ""},
+		{"Private owner", "alice@example.com", "/snippet/3", http.StatusMovedPermanently, snippetPath(t, app, 3)},
+		{"Non-existent ID", "", "/snippet/4", http.StatusNotFound, ""},
+		{"Negative ID", "", "/snippet/-1", http.StatusNotFound, ""},
+		{"Decimal ID", "", "/snippet/1.23", http.StatusNotFound, ""},
+		{"String ID", "", "/snippet/foo", http.StatusNotFound, ""},
+		{"Empty ID", "", "/snippet/", http.StatusNotFound, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.email != "" {
+				server.login(t, tt.email, "validPa$$word")
+			}
+			code, header, _ := server.get(t, tt.urlPath)
+			if code != tt.wantCode {
+				t.Errorf("want %d; got %d", tt.wantCode, code)
+			}
+			if got := header.Get("Location"); got != tt.wantLocation {
+				t.Errorf("want Location %q; got %q", tt.wantLocation, got)
+			} else if got != "" {
+				if code, _, _ := server.get(t, got); code != http.StatusOK {
+					t.Errorf("follow redirect: want %d; got %d", http.StatusOK, code)
+				}
+			}
+		})
+	}
+}
+
+// TestCreateSnippet checks that a snippet is created with its language and tags, and that they are validated
+func TestCreateSnippet(t *testing.T) {
+	app := newTestApplication(t)
+	server := newTestServer(t, app.routes(""))
+	defer server.Close()
+
+	server.login(t, "alice@example.com", "validPa$$word")
+	_, _, body := server.get(t, "/snippet/create")
+	csrfToken := extractCSRFToken(t, []byte(body))
+
+	tests := []struct {
+		name         string
+		content      string
+		language     string
+		tags         string
+		wantCode     int
+		wantBody     string
+		wantLanguage string
+		wantTags     []string
+	}{
+		{"No tags", "Content", "", "", http.StatusSeeOther, "", "", []string{}},
+		{"Tags", "Content", "", "SQL, bash  k8s,sql", http.StatusSeeOther, "", "", []string{"bash", "k8s", "sql"}},
+		{"Punctuation", "Content", "", "c++ c# node.js", http.StatusSeeOther, "", "", []string{"c#", "c++", "node.js"}},
+		{"Too many", "Content", "", "a b c d e f", http.StatusOK, "Too many tags (maximum is 5)", "", nil},
+		{"Too long", "Content", "", strings.Repeat("x", 31), http.StatusOK, "is too long (maximum is 30 characters)", "", nil},
+		{"Invalid", "Content", "", "sql ba/sh", http.StatusOK, "Tag &#34;ba/sh&#34; is invalid", "", nil},
+		{"Language", "SELECT 1", "sql", "", http.StatusSeeOther, "", "sql", []string{}},
+		{"Detect language", "#!/bin/bash\necho 1", "auto", "", http.StatusSeeOther, "", "bash", []string{}},
+		{"Not detected", "Content", "auto", "", http.StatusSeeOther, "", "", []string{}},
+		{"Invalid language", "Content", "cobol", "", http.StatusOK, "This field is invalid", "", nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			form := url.Values{}
+			form.Add("title", "Title")
+			form.Add("content", tt.content)
+			form.Add("language", tt.language)
+			form.Add("expires", "7d")
+			form.Add("tags", tt.tags)
+			form.Add("csrf_token", csrfToken)
+			code, header, body := server.postForm(t, "/snippet/create", form)
+			if code != tt.wantCode {
+				t.Fatalf("want %d; got %d", tt.wantCode, code)
+			}
+			if !strings.Contains(string(body), tt.wantBody) {
+				t.Errorf("want body to contain %q", tt.wantBody)
+			}
+			if tt.wantTags == nil {
+				return
+			}
+
+			// Check the language and tags of the new snippet
+			s, err := app.snippets.GetBySlug(strings.TrimPrefix(header.Get("Location"), "/s/"))
+			if err != nil || s == nil {
+				t.Fatalf("want new snippet at %q; got %v, %v", header.Get("Location"), s, err)
+			}
+			if s.Language != tt.wantLanguage {
+				t.Errorf("want language %q; got %q", tt.wantLanguage, s.Language)
+			}
+			if tags, err := app.snippets.Tags(s.ID); err != nil || !reflect.DeepEqual(tags, tt.wantTags) {
+				t.Errorf("want tags %v; got %v, %v", tt.wantTags, tags, err)
+			}
+		})
+	}
+}
+
+// TestCreateSnippetExpiry checks the choices of when a new snippet expires, including a custom time and
+// the server's maximum
+func TestCreateSnippetExpiry(t *testing.T) {
+	app := newTestApplication(t)
+	server := newTestServer(t, app.routes(""))
+	defer server.Close()
+
+	server.login(t, "alice@example.com", "validPa$$word")
+	_, _, body := server.get(t, "/snippet/create")
+	csrfToken := extractCSRFToken(t, []byte(body))
+	if !strings.Contains(body, "value='365d' checked") || !strings.Contains(body, "value='never'") {
+		t.Errorf("form: want one year selected and never offered")
+	}
+
+	now := time.Now().UTC()
+	at := now.Add(48 * time.Hour).Truncate(time.Minute)
+	tests := []struct {
+		name        string
+		maxExpiry   time.Duration
+		expires     string
+		expiresAt   string
+		wantBody    string // error if not created
+		wantExpires time.Time
+	}{
+		{"Minutes", 0, "10m", "", "", now.Add(10 * time.Minute)},
+		{"Hours", 0, "1h", "", "", now.Add(time.Hour)},
+		{"Days", 0, "7d", "", "", now.AddDate(0, 0, 7)},
+		{"Unlisted duration", 0, "1d12h", "", "", now.Add(36 * time.Hour)},
+		{"Never", 0, "never", "", "", models.Never},
+		{"Custom", 0, "custom", at.Format(expiresAtLayout), "", at},
+		{"Too short", 0, "30s", "", "This is too short (minimum is 1 minute)", time.Time{}},
+		{"Negative", 0, "-1h", "", "This field is invalid", time.Time{}},
+		{"Invalid", 0, "soon", "", "This field is invalid", time.Time{}},
+		{"Custom missing", 0, "custom", "", "This field cannot be blank", time.Time{}},
+		{"Custom invalid", 0, "custom", "tomorrow", "This field is invalid", time.Time{}},
+		{"Custom passed", 0, "custom", now.Add(-time.Hour).Format(expiresAtLayout), "This time has already passed", time.Time{}},
+		{"Custom too soon", 0, "custom", now.Add(time.Minute).Format(expiresAtLayout), "This is too soon (minimum is 1 minute ahead)", time.Time{}}, // layout truncates to under a minute ahead
+		{"Within maximum", 30 * 24 * time.Hour, "7d", "", "", now.AddDate(0, 0, 7)},
+		{"Over maximum", 30 * 24 * time.Hour, "365d", "", "This is too long (maximum is 30 days)", time.Time{}},
+		{"Never over maximum", 30 * 24 * time.Hour, "never", "", "This field is invalid", time.Time{}},
+		{"Custom over maximum", 24 * time.Hour, "custom", at.Format(expiresAtLayout), "This is too far ahead (maximum is 1 day)", time.Time{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app.maxExpiry = tt.maxExpiry
+			form := url.Values{}
+			form.Add("title", "Title")
+			form.Add("content", "Content")
+			form.Add("expires", tt.expires)
+			form.Add("expires_at", tt.expiresAt)
+			form.Add("csrf_token", csrfToken)
+			code, header, body := server.postForm(t, "/snippet/create", form)
+			if tt.wantBody != "" {
+				if code != http.StatusOK || !strings.Contains(string(body), tt.wantBody) {
+					t.Errorf("want %d and %q; got %d", http.StatusOK, tt.wantBody, code)
+				}
+				return
+			}
+			if code != http.StatusSeeOther {
+				t.Fatalf("want %d; got %d", http.StatusSeeOther, code)
+			}
+
+			s, err := app.snippets.GetBySlug(strings.TrimPrefix(header.Get("Location"), "/s/"))
+			if err != nil || s == nil {
+				t.Fatalf("want new snippet at %q; got %v, %v", header.Get("Location"), s, err)
+			}
+			if diff := s.Expires.Sub(tt.wantExpires); diff < -time.Minute || diff > time.Minute {
+				t.Errorf("want expires about %v; got %v", tt.wantExpires, s.Expires)
+			}
+		})
+	}
+
+	// With a maximum only the allowed choices are offered
+	app.maxExpiry = 7 * 24 * time.Hour
+	_, _, body = server.get(t, "/snippet/create")
+	if !strings.Contains(body, "value='7d' checked") || strings.Contains(body, "value='365d'") || strings.Contains(body, "value='never'") {
+		t.Errorf("form with maximum: want one week selected and no longer choices")
+	}
+}
+
+// TestTagSnippets checks that tags are shown with a snippet and link to a page listing snippets with the tag
+func TestTagSnippets(t *testing.T) {
+	app := newTestApplication(t)
+	id, _, err := app.snippets.Insert(1, "Another haiku", "Content", "", models.Public, time.Now().AddDate(0, 0, 1), "", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = app.snippets.SetTags(1, []string{"c#", "haiku"}); err != nil {
+		t.Fatal(err)
+	}
+	if err = app.snippets.SetTags(id, []string{"haiku"}); err != nil {
+		t.Fatal(err)
+	}
+	server := newTestServer(t, app.routes(""))
+	defer server.Close()
+
+	tests := []struct {
+		name     string
+		urlPath  string
+		wantCode int
+		wantBody []string
+		notBody  []string
+	}{
+		{"Show", snippetPath(t, app, 1), http.StatusOK,
+			[]string{"<a class='tag' href='/tag/c%23'>c#</a>", "<a class='tag' href='/tag/haiku'>haiku</a>"}, nil},
+		{"Tag", "/tag/haiku", http.StatusOK, []string{"An old silent pond", "Another haiku"}, nil},
+		{"Escaped tag", "/tag/c%23", http.StatusOK, []string{"An old silent pond"}, []string{"Another haiku"}},
+		{"Unused tag", "/tag/go", http.StatusOK, []string{"No snippets have this tag"}, nil},
+		{"Invalid tag", "/tag/Go", http.StatusNotFound, nil, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			code, _, body := server.get(t, tt.urlPath)
+			if code != tt.wantCode {
+				t.Errorf("want %d; got %d", tt.wantCode, code)
+			}
+			for _, want := range tt.wantBody {
+				if !strings.Contains(body, want) {
+					t.Errorf("want body to contain %q", want)
+				}
+			}
+			for _, notWant := range tt.notBody {
+				if strings.Contains(body, notWant) {
+					t.Errorf("want body not to contain %q", notWant)
+				}
+			}
+		})
+	}
+}
+
 // TestSignupUser tests requests for the signup page (form)
 func TestSignupUser(t *testing.T) {
 	app := newTestApplication(t)
@@ -192,3 +555,872 @@ func TestSignupUser(t *testing.T) {
 		})
 	}
 }
+
+// TestSignupLogsIn checks that signing up logs the new user in (with a new session) and goes back to
+// the page they were trying to reach
+func TestSignupLogsIn(t *testing.T) {
+	app := newTestApplication(t)
+	server := newTestServer(t, app.routes(""))
+	defer server.Close()
+
+	// Unlock a protected snippet then try to create a snippet without being logged in
+	_, slug, err := app.snippets.Insert(1, "Locked", "Content", "", models.Unlisted, time.Now().AddDate(0, 0, 1), "open sesame", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, _, body := server.get(t, snippetURL(slug))
+	unlock := url.Values{}
+	unlock.Add("password", "open sesame")
+	unlock.Add("csrf_token", extractCSRFToken(t, []byte(body)))
+	if code, _, _ := server.postForm(t, snippetURL(slug)+"/unlock", unlock); code != http.StatusSeeOther {
+		t.Fatalf("unlock: want %d; got %d", http.StatusSeeOther, code)
+	}
+	if code, _, _ := server.browse(t, "/snippet/create"); code != http.StatusSeeOther {
+		t.Fatalf("create: want %d; got %d", http.StatusSeeOther, code)
+	}
+
+	// Signing up logs in and goes back to the page that was wanted
+	_, _, body = server.get(t, "/user/signup")
+	form := url.Values{}
+	form.Add("name", "Bob")
+	form.Add("email", "bob@example.com")
+	form.Add("password", "validPa$$word")
+	form.Add("csrf_token", extractCSRFToken(t, []byte(body)))
+	code, header, _ := server.postForm(t, "/user/signup", form)
+	if code != http.StatusSeeOther || header.Get("Location") != "/snippet/create" {
+		t.Fatalf("signup: want %d to %s; got %d to %s", http.StatusSeeOther, "/snippet/create", code, header.Get("Location"))
+	}
+	code, _, body = server.get(t, "/snippet/create")
+	if code != http.StatusOK || !strings.Contains(body, "Welcome Bob") {
+		t.Errorf("after signup: want %d and welcome; got %d", http.StatusOK, code)
+	}
+
+	// Nothing from before signing up is kept in the new session
+	if _, _, body := server.get(t, snippetURL(slug)); !strings.Contains(body, "Enter its password") {
+		t.Errorf("want snippet locked in new session")
+	}
+}
+
+// TestRequireAuthenticatedUser checks that browsers are sent to log in (and back) but other clients get a 401
+func TestRequireAuthenticatedUser(t *testing.T) {
+	app := newTestApplication(t)
+	server := newTestServer(t, app.routes(""))
+	defer server.Close()
+
+	// Scripts (API clients) just get an error
+	if code, _, _ := server.getAccept(t, "/user/snippets", "application/json"); code != http.StatusUnauthorized {
+		t.Errorf("API client: want %d; got %d", http.StatusUnauthorized, code)
+	}
+
+	// Browsers are sent to the login page then back to the page they wanted
+	code, header, _ := server.browse(t, "/user/snippets?x=1")
+	if code != http.StatusSeeOther || header.Get("Location") != "/user/login" {
+		t.Fatalf("browser: want %d to /user/login; got %d to %s", http.StatusSeeOther, code, header.Get("Location"))
+	}
+	_, _, body := server.browse(t, "/user/login")
+	if !strings.Contains(body, "Please log in first") {
+		t.Errorf("login page: want message")
+	}
+	form := url.Values{}
+	form.Add("email", "alice@example.com")
+	form.Add("password", "validPa$$word")
+	form.Add("csrf_token", extractCSRFToken(t, []byte(body)))
+	code, header, _ = server.postForm(t, "/user/login", form)
+	if code != http.StatusSeeOther || header.Get("Location") != "/user/snippets?x=1" {
+		t.Errorf("login: want %d to /user/snippets?x=1; got %d to %s", http.StatusSeeOther, code, header.Get("Location"))
+	}
+
+	// The page is only remembered until the next login
+	_, _, body = server.get(t, "/")
+	logout := url.Values{}
+	logout.Add("csrf_token", extractCSRFToken(t, []byte(body)))
+	server.postForm(t, "/user/logout", logout)
+	code, header, _ = server.postForm(t, "/user/login", form)
+	if code != http.StatusSeeOther || header.Get("Location") != "/" {
+		t.Errorf("second login: want %d to /; got %d to %s", http.StatusSeeOther, code, header.Get("Location"))
+	}
+}
+
+// TestVerifyUser checks that new users must open the emailed link before they can create snippets
+func TestVerifyUser(t *testing.T) {
+	app := newTestApplication(t)
+	server := newTestServer(t, app.routes(""))
+	defer server.Close()
+
+	// Signing up emails a verification link to the new user
+	_, _, body := server.get(t, "/user/signup")
+	form := url.Values{}
+	form.Add("name", "Bob")
+	form.Add("email", "bob@example.com")
+	form.Add("password", "validPa$$word")
+	form.Add("csrf_token", extractCSRFToken(t, []byte(body)))
+	if code, _, _ := server.postForm(t, "/user/signup", form); code != http.StatusSeeOther {
+		t.Fatalf("signup: want %d; got %d", http.StatusSeeOther, code)
+	}
+	msg := app.mailer.(*testMailer).last(t)
+	link := regexp.MustCompile(`https://snippetbox\.example\.com(/user/verify/\S+)`).FindStringSubmatch(msg.Body)
+	if msg.To != "bob@example.com" || link == nil {
+		t.Fatalf("want verification link sent to bob@example.com; got %q to %s", msg.Body, msg.To)
+	}
+
+	// Snippets can't be created until the address is verified
+	_, _, body = server.get(t, "/snippet/create")
+	if !strings.Contains(body, "Resend verification email") {
+		t.Errorf("create unverified: want verify page")
+	}
+	create := url.Values{}
+	create.Add("title", "Frog")
+	create.Add("content", "A frog jumps")
+	create.Add("expires", "1d")
+	create.Add("csrf_token", extractCSRFToken(t, []byte(body)))
+	if _, _, body := server.postForm(t, "/snippet/create", create); !bytes.Contains(body, []byte("Resend verification email")) {
+		t.Errorf("post create unverified: want verify page")
+	}
+
+	// Resending sends a new link and the old one still works until one is used
+	resend := url.Values{}
+	resend.Add("csrf_token", extractCSRFToken(t, []byte(body)))
+	if code, _, _ := server.postForm(t, "/user/verify", resend); code != http.StatusSeeOther {
+		t.Fatalf("resend: want %d; got %d", http.StatusSeeOther, code)
+	}
+	if got := app.mailer.(*testMailer).last(t); got.Body == msg.Body {
+		t.Errorf("resend: want a new link")
+	}
+
+	// Bad links are rejected and a link can only be used once
+	for _, tt := range []struct {
+		path string
+		want string
+	}{
+		{"/user/verify/nonsense", "invalid or has expired"},
+		{link[1], "has been verified"},
+		{link[1], "invalid or has expired"},
+	} {
+		code, header, _ := server.get(t, tt.path)
+		if code != http.StatusSeeOther || header.Get("Location") != "/" {
+			t.Errorf("%s: want %d to /; got %d to %s", tt.path, http.StatusSeeOther, code, header.Get("Location"))
+		}
+		if _, _, body := server.get(t, "/"); !strings.Contains(body, tt.want) {
+			t.Errorf("%s: want flash %q", tt.path, tt.want)
+		}
+	}
+
+	// Once verified, snippets can be created
+	_, _, body = server.get(t, "/snippet/create")
+	create.Set("csrf_token", extractCSRFToken(t, []byte(body)))
+	if code, header, _ := server.postForm(t, "/snippet/create", create); code != http.StatusSeeOther || !strings.HasPrefix(header.Get("Location"), "/s/") {
+		t.Errorf("create verified: want %d to snippet; got %d to %s", http.StatusSeeOther, code, header.Get("Location"))
+	}
+}
+
+// TestResetPassword checks that a forgotten password can be reset using an emailed link, which ends
+// the user's other sessions
+func TestResetPassword(t *testing.T) {
+	app := newTestApplication(t)
+	server := newTestServer(t, app.routes(""))
+	defer server.Close()
+
+	// Alice is logged in on another client (eg her phone)
+	other := newTestServer(t, app.routes(""))
+	defer other.Close()
+	other.login(t, "alice@example.com", "validPa$$word")
+	if code, _, _ := other.get(t, "/user/snippets"); code != http.StatusOK {
+		t.Fatalf("other session: want %d; got %d", http.StatusOK, code)
+	}
+
+	// Asking for a reset of an unknown address looks the same but sends no email
+	forgot := func(email string) {
+		t.Helper()
+		_, _, body := server.get(t, "/user/forgot")
+		form := url.Values{}
+		form.Add("email", email)
+		form.Add("csrf_token", extractCSRFToken(t, []byte(body)))
+		code, header, _ := server.postForm(t, "/user/forgot", form)
+		if code != http.StatusSeeOther || header.Get("Location") != "/user/login" {
+			t.Fatalf("forgot %s: want %d to /user/login; got %d to %s", email, http.StatusSeeOther, code, header.Get("Location"))
+		}
+	}
+	forgot("nobody@example.com")
+	if n := len(app.mailer.(*testMailer).sent); n != 0 {
+		t.Errorf("unknown address: want no email; got %d", n)
+	}
+
+	// Failing to send the email also looks the same
+	app.mailer.(*testMailer).err = errors.New("mail server down")
+	forgot("alice@example.com")
+	app.mailer.(*testMailer).err = nil
+
+	forgot("alice@example.com")
+	msg := app.mailer.(*testMailer).last(t)
+	link := regexp.MustCompile(`https://snippetbox\.example\.com(/user/reset/\S+)`).FindStringSubmatch(msg.Body)
+	if msg.To != "alice@example.com" || link == nil {
+		t.Fatalf("want reset link sent to alice@example.com; got %q to %s", msg.Body, msg.To)
+	}
+
+	// The new password must follow the signup rules
+	reset := func(path, password string) (int, http.Header, []byte) {
+		t.Helper()
+		_, _, body := server.get(t, path)
+		form := url.Values{}
+		form.Add("password", password)
+		form.Add("csrf_token", extractCSRFToken(t, []byte(body)))
+		return server.postForm(t, path, form)
+	}
+	if code, _, body := reset(link[1], "short"); code != http.StatusOK || !bytes.Contains(body, []byte("too short")) {
+		t.Errorf("short password: want %d and error; got %d", http.StatusOK, code)
+	}
+	if code, header, _ := reset("/user/reset/nonsense", "newPa$$word1"); code != http.StatusSeeOther || header.Get("Location") != "/user/forgot" {
+		t.Errorf("bad token: want %d to /user/forgot; got %d to %s", http.StatusSeeOther, code, header.Get("Location"))
+	}
+
+	code, header, _ := reset(link[1], "newPa$$word1")
+	if code != http.StatusSeeOther || header.Get("Location") != "/user/login" {
+		t.Fatalf("reset: want %d to /user/login; got %d to %s", http.StatusSeeOther, code, header.Get("Location"))
+	}
+	if code, header, _ := reset(link[1], "otherPa$$word"); code != http.StatusSeeOther || header.Get("Location") != "/user/forgot" {
+		t.Errorf("reset again: want %d to /user/forgot; got %d to %s", http.StatusSeeOther, code, header.Get("Location"))
+	}
+
+	// The other session has ended and only the new password works
+	if code, _, _ := other.get(t, "/user/snippets"); code != http.StatusUnauthorized {
+		t.Errorf("other session after reset: want %d; got %d", http.StatusUnauthorized, code)
+	}
+	if _, _, err := app.users.Authenticate("alice@example.com", "validPa$$word"); err != models.ErrInvalidCredentials {
+		t.Errorf("old password: want %v; got %v", models.ErrInvalidCredentials, err)
+	}
+	other.login(t, "alice@example.com", "newPa$$word1")
+	if code, _, _ := other.get(t, "/user/snippets"); code != http.StatusOK {
+		t.Errorf("new session: want %d; got %d", http.StatusOK, code)
+	}
+}
+
+// TestUserProfile checks that users can change their name, email address and password on the profile page
+func TestUserProfile(t *testing.T) {
+	app := newTestApplication(t)
+	server := newTestServer(t, app.routes(""))
+	defer server.Close()
+	if _, err := app.users.Insert("Bob", "bob@example.com", "validPa$$word"); err != nil {
+		t.Fatal(err)
+	}
+
+	// Alice is also logged in on another client (eg her phone)
+	other := newTestServer(t, app.routes(""))
+	defer other.Close()
+	other.login(t, "alice@example.com", "validPa$$word")
+
+	if code, _, _ := server.get(t, "/user/profile"); code != http.StatusUnauthorized {
+		t.Errorf("not logged in: want %d; got %d", http.StatusUnauthorized, code)
+	}
+	server.login(t, "alice@example.com", "validPa$$word")
+	code, _, body := server.get(t, "/user/profile")
+	if code != http.StatusOK || !strings.Contains(body, "alice@example.com") || strings.Contains(body, "not verified") {
+		t.Fatalf("profile: want %d with Alice's verified address; got %d", http.StatusOK, code)
+	}
+
+	// post submits one of the forms of the profile page
+	post := func(path string, form url.Values) (int, http.Header, []byte) {
+		t.Helper()
+		_, _, body := server.get(t, "/user/profile")
+		form.Set("csrf_token", extractCSRFToken(t, []byte(body)))
+		return server.postForm(t, path, form)
+	}
+
+	// The forms are submitted in order as each step depends on the ones before
+	tests := []struct {
+		name     string
+		path     string
+		form     url.Values
+		wantCode int
+		wantBody string // in the response (if OK) or after being redirected to the profile page
+	}{
+		{"Blank name", "/user/profile/name", url.Values{"name": {""}}, http.StatusOK, "This field cannot be blank"},
+		{"Name", "/user/profile/name", url.Values{"name": {"Alicia"}}, http.StatusSeeOther, "Your name has been changed"},
+		{"Invalid email", "/user/profile/email", url.Values{"email": {"alice"}}, http.StatusOK, "This field is invalid"},
+		{"Duplicate email", "/user/profile/email", url.Values{"email": {"bob@example.com"}}, http.StatusOK, "Address is already in use"},
+		{"Email", "/user/profile/email", url.Values{"email": {"alicia@example.com"}}, http.StatusSeeOther, "not verified"},
+		{"Wrong password", "/user/profile/password", url.Values{"current_password": {"wrongPa$$word"}, "password": {"newPa$$word1"}}, http.StatusOK, "Incorrect password"},
+		{"Short password", "/user/profile/password", url.Values{"current_password": {"validPa$$word"}, "password": {"short"}}, http.StatusOK, "too short"},
+		{"Change password", "/user/profile/password", url.Values{"current_password": {"validPa$$word"}, "password": {"newPa$$word1"}}, http.StatusSeeOther, "Your password has been changed"},
+		{"Still logged in", "/user/profile/name", url.Values{"name": {"Alice"}}, http.StatusSeeOther, "Your name has been changed"},
+		{"Old is forgotten", "/user/profile/password", url.Values{"current_password": {"validPa$$word"}, "password": {"otherPa$$word"}}, http.StatusOK, "Incorrect password"},
+	}
+	for _, tt := range tests {
+		code, header, body := post(tt.path, tt.form)
+		if code != tt.wantCode {
+			t.Errorf("%s: want %d; got %d", tt.name, tt.wantCode, code)
+			continue
+		}
+		if code == http.StatusSeeOther {
+			if header.Get("Location") != "/user/profile" {
+				t.Errorf("%s: want redirect to /user/profile; got %s", tt.name, header.Get("Location"))
+			}
+			_, _, page := server.get(t, "/user/profile")
+			body = []byte(page)
+		}
+		if !bytes.Contains(body, []byte(html.EscapeString(tt.wantBody))) {
+			t.Errorf("%s: want body to contain %q", tt.name, tt.wantBody)
+		}
+	}
+
+	// The new address was sent a verification email and Alice must log in with her new details
+	if msg := app.mailer.(*testMailer).last(t); msg.To != "alicia@example.com" {
+		t.Errorf("want verification email to alicia@example.com; got %s", msg.To)
+	}
+	if code, _, _ := other.get(t, "/user/snippets"); code != http.StatusUnauthorized {
+		t.Errorf("other session after password change: want %d; got %d", http.StatusUnauthorized, code)
+	}
+	other.login(t, "alicia@example.com", "newPa$$word1")
+}
+
+// TestUserSnippets tests the "My snippets" page which lists the snippets created by the logged in user
+func TestUserSnippets(t *testing.T) {
+	app := newTestApplication(t)
+	server := newTestServer(t, app.routes(""))
+	defer server.Close()
+
+	// Must be logged in
+	if code, _, _ := server.get(t, "/user/snippets"); code != http.StatusUnauthorized {
+		t.Errorf("want %d; got %d", http.StatusUnauthorized, code)
+	}
+
+	server.login(t, "alice@example.com", "validPa$$word")
+	code, _, body := server.get(t, "/user/snippets")
+	if code != http.StatusOK {
+		t.Errorf("want %d; got %d", http.StatusOK, code)
+	}
+	if !strings.Contains(body, "<a href='"+snippetPath(t, app, 1)+"'>An old silent pond</a>") {
+		t.Errorf("expected body to contain link to snippet 1")
+	}
+}
+
+// TestEditSnippet checks that only the owner of a snippet can change it
+func TestEditSnippet(t *testing.T) {
+	app := newTestApplication(t)
+	if _, err := app.users.Insert("Bob", "bob@example.com", "validPa$$word"); err != nil {
+		t.Fatal(err)
+	}
+	server := newTestServer(t, app.routes(""))
+	defer server.Close()
+	path := snippetPath(t, app, 1)
+
+	// Not logged in
+	if code, _, _ := server.get(t, path+"/edit"); code != http.StatusUnauthorized {
+		t.Errorf("want %d; got %d", http.StatusUnauthorized, code)
+	}
+
+	// Not the owner
+	server.login(t, "bob@example.com", "validPa$$word")
+	if code, _, _ := server.get(t, path+"/edit"); code != http.StatusForbidden {
+		t.Errorf("want %d; got %d", http.StatusForbidden, code)
+	}
+
+	// The owner sees the form filled in with the current values
+	server.login(t, "alice@example.com", "validPa$$word")
+	if code, _, _ := server.get(t, "/s/AAAAAAAAAAAA/edit"); code != http.StatusNotFound {
+		t.Errorf("want %d; got %d", http.StatusNotFound, code)
+	}
+	code, _, body := server.get(t, path+"/edit")
+	if code != http.StatusOK {
+		t.Fatalf("want %d; got %d", http.StatusOK, code)
+	}
+	if !strings.Contains(body, "An old silent pond...</textarea>") {
+		t.Errorf("expected body to contain current content")
+	}
+
+	tests := []struct {
+		name     string
+		title    string
+		wantCode int
+		wantBody string
+	}{
+		{"Empty title", "", http.StatusOK, "This field cannot be blank"},
+		{"Valid", "A new title", http.StatusSeeOther, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			form := url.Values{}
+			form.Add("title", tt.title)
+			form.Add("content", "New content")
+			form.Add("csrf_token", extractCSRFToken(t, []byte(body)))
+			code, _, body := server.postForm(t, path+"/edit", form)
+			if code != tt.wantCode {
+				t.Errorf("want %d; got %d", tt.wantCode, code)
+			}
+			if !strings.Contains(string(body), tt.wantBody) {
+				t.Errorf("want body to contain %q", tt.wantBody)
+			}
+		})
+	}
+
+	if s, _ := app.snippets.Get(1); s == nil || s.Title != "A new title" || s.Content != "New content" {
+		t.Errorf("snippet not updated: %+v", s)
+	}
+}
+
+// TestSnippetHistory checks that anyone can see the revisions of a snippet
+func TestSnippetHistory(t *testing.T) {
+	app := newTestApplication(t)
+	if err := app.snippets.Update(1, "A new title", "An old silent pond...\nA frog jumps into the pond", "", models.Public); err != nil {
+		t.Fatal(err)
+	}
+	server := newTestServer(t, app.routes(""))
+	defer server.Close()
+	path := snippetPath(t, app, 1)
+
+	tests := []struct {
+		name     string
+		urlPath  string
+		wantCode int
+		wantBody []string
+	}{
+		{"Valid", path + "/history", http.StatusOK, []string{"<td>An old silent pond</td>", "<td>A new title</td>"}},
+		{"Non-existent slug", "/s/AAAAAAAAAAAA/history", http.StatusNotFound, nil},
+		{"ID not slug", "/s/1/history", http.StatusNotFound, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			code, _, body := server.get(t, tt.urlPath)
+			if code != tt.wantCode {
+				t.Errorf("want %d; got %d", tt.wantCode, code)
+			}
+			for _, want := range tt.wantBody {
+				if !strings.Contains(body, want) {
+					t.Errorf("want body to contain %q", want)
+				}
+			}
+		})
+	}
+}
+
+// TestSnippetDiff checks the differences shown between revisions of a snippet
+func TestSnippetDiff(t *testing.T) {
+	app := newTestApplication(t)
+	if err := app.snippets.Update(1, "A new title", "An old silent pond...\nA frog jumps into the pond", "", models.Public); err != nil {
+		t.Fatal(err)
+	}
+	server := newTestServer(t, app.routes(""))
+	defer server.Close()
+	path := snippetPath(t, app, 1)
+
+	tests := []struct {
+		name     string
+		urlPath  string
+		wantCode int
+		wantBody []string
+	}{
+		// Note that html/template escapes "+" as "&#43;"
+		{"Default", path + "/diff", http.StatusOK, []string{
+			"Revision 1 to 2",
+			"<span class='header'>@@ -1,1 &#43;1,2 @@</span>",
+			"<span class=''> An old silent pond...</span>",
+			"<span class='added'>&#43;A frog jumps into the pond</span>",
+			"<span class='removed'>-An old silent pond</span>",
+		}},
+		{"Reversed", path + "/diff?from=2&to=1", http.StatusOK, []string{
+			"<span class='removed'>-A frog jumps into the pond</span>",
+		}},
+		{"Same", path + "/diff?from=1&to=1", http.StatusOK, []string{"The content is the same"}},
+		{"Non-existent revision", path + "/diff?from=1&to=3", http.StatusNotFound, nil},
+		{"Invalid revision", path + "/diff?from=x", http.StatusBadRequest, nil},
+		{"Non-existent slug", "/s/AAAAAAAAAAAA/diff", http.StatusNotFound, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			code, _, body := server.get(t, tt.urlPath)
+			if code != tt.wantCode {
+				t.Errorf("want %d; got %d", tt.wantCode, code)
+			}
+			for _, want := range tt.wantBody {
+				if !strings.Contains(body, want) {
+					t.Errorf("want body to contain %q", want)
+				}
+			}
+		})
+	}
+}
+
+// TestRawSnippet checks that the content of a snippet is sent exactly as plain text
+func TestRawSnippet(t *testing.T) {
+	app := newTestApplication(t)
+	content := "package main\n\nfunc main() {\n\tprintln(\"<b>\")\n}\n"
+	_, slug, err := app.snippets.Insert(1, "Hello, World!", content, "go", models.Public, time.Now().AddDate(0, 0, 7), "", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := newTestServer(t, app.routes(""))
+	defer server.Close()
+	path := snippetPath(t, app, 1)
+
+	tests := []struct {
+		name            string
+		urlPath         string
+		wantCode        int
+		wantBody        string
+		wantDisposition string
+	}{
+		{"Raw", snippetURL(slug) + "/raw", http.StatusOK, content, `inline; filename=hello-world.go`},
+		{"Download", snippetURL(slug) + "/download", http.StatusOK, content, `attachment; filename=hello-world.go`},
+		{"Plain text", path + "/download", http.StatusOK, "An old silent pond...", `attachment; filename=an-old-silent-pond.txt`},
+		{"Non-existent slug", "/s/AAAAAAAAAAAA/raw", http.StatusNotFound, "", ""},
+		{"ID not slug", "/s/1/download", http.StatusNotFound, "", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			code, header, body := server.get(t, tt.urlPath)
+			if code != tt.wantCode {
+				t.Fatalf("want %d; got %d", tt.wantCode, code)
+			}
+			if code != http.StatusOK {
+				return
+			}
+			if body != tt.wantBody {
+				t.Errorf("want body %q; got %q", tt.wantBody, body)
+			}
+			if got := header.Get("Content-Type"); got != "text/plain; charset=utf-8" {
+				t.Errorf("want text/plain; got %q", got)
+			}
+			if got := header.Get("Content-Disposition"); got != tt.wantDisposition {
+				t.Errorf("want Content-Disposition %q; got %q", tt.wantDisposition, got)
+			}
+			if got := header.Get("Cache-Control"); got != "private, no-cache" {
+				t.Errorf("want Cache-Control %q; got %q", "private, no-cache", got)
+			}
+
+			// Check that a cached copy can be used if the snippet has not changed
+			request, err := http.NewRequest(http.MethodGet, server.URL+tt.urlPath, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			request.Header.Set("If-None-Match", header.Get("ETag"))
+			response, err := server.Client().Do(request)
+			if err != nil {
+				t.Fatal(err)
+			}
+			response.Body.Close()
+			if response.StatusCode != http.StatusNotModified {
+				t.Errorf("want %d for unchanged snippet; got %d", http.StatusNotModified, response.StatusCode)
+			}
+		})
+	}
+
+	// Editing the snippet must change the ETag
+	_, header, _ := server.get(t, path+"/raw")
+	if err := app.snippets.Update(1, "An old silent pond", "A frog jumps into the pond", "", models.Public); err != nil {
+		t.Fatal(err)
+	}
+	if _, header2, _ := server.get(t, path+"/raw"); header2.Get("ETag") == header.Get("ETag") {
+		t.Errorf("ETag unchanged after edit: %s", header.Get("ETag"))
+	}
+}
+
+// TestSnippetVisibility checks that unlisted snippets are not listed and that private snippets
+// can only be seen by their owner
+func TestSnippetVisibility(t *testing.T) {
+	app := newTestApplication(t)
+	if _, err := app.users.Insert("Bob", "bob@example.com", "validPa$$word"); err != nil {
+		t.Fatal(err)
+	}
+	server := newTestServer(t, app.routes(""))
+	defer server.Close()
+
+	// Alice creates an unlisted and a private snippet
+	server.login(t, "alice@example.com", "validPa$$word")
+	_, _, body := server.get(t, "/snippet/create")
+	for _, visibility := range []string{models.Unlisted, models.Private} {
+		form := url.Values{}
+		form.Add("title", "A "+visibility+" haiku")
+		form.Add("content", "Content")
+		form.Add("visibility", visibility)
+		form.Add("expires", "7d")
+		form.Add("csrf_token", extractCSRFToken(t, []byte(body)))
+		if code, _, _ := server.postForm(t, "/snippet/create", form); code != http.StatusSeeOther {
+			t.Fatalf("create %s: want %d; got %d", visibility, http.StatusSeeOther, code)
+		}
+	}
+	unlisted, private := snippetPath(t, app, 2), snippetPath(t, app, 3)
+	if s, _ := app.snippets.Get(3); s == nil || s.Visibility != models.Private {
+		t.Fatalf("want private snippet; got %+v", s)
+	}
+
+	tests := []struct {
+		name     string
+		email    string // who is logged in (if anyone)
+		urlPath  string
+		wantCode int
+		wantBody string
+		hideBody []string
+	}{
+		{"Home", "", "/", http.StatusOK, "An old silent pond", []string{unlisted + "'", private + "'"}},
+		{"Search", "", "/search?q=haiku", http.StatusOK, "", []string{unlisted + "'", private + "'"}},
+		{"Unlisted", "", unlisted, http.StatusOK, "A unlisted haiku", nil},
+		{"Unlisted raw", "", unlisted + "/raw", http.StatusOK, "Content", nil},
+		{"Private", "", private, http.StatusNotFound, "", nil},
+		{"Private raw", "", private + "/raw", http.StatusNotFound, "", nil},
+		{"Private history", "", private + "/history", http.StatusNotFound, "", nil},
+		{"Other user", "bob@example.com", private, http.StatusNotFound, "", nil},
+		{"Other user edit", "bob@example.com", private + "/edit", http.StatusNotFound, "", nil},
+		{"Owner", "alice@example.com", private, http.StatusOK, "A private haiku", nil},
+		{"Owner list", "alice@example.com", "/user/snippets", http.StatusOK, private + "'", nil},
+		{"Owner home", "alice@example.com", "/", http.StatusOK, "An old silent pond", []string{unlisted + "'", private + "'"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := newTestServer(t, app.routes("")) // new cookie jar so not logged in
+			defer server.Close()
+			if tt.email != "" {
+				server.login(t, tt.email, "validPa$$word")
+			}
+
+			code, _, body := server.get(t, tt.urlPath)
+			if code != tt.wantCode {
+				t.Errorf("want %d; got %d", tt.wantCode, code)
+			}
+			if !strings.Contains(body, tt.wantBody) {
+				t.Errorf("want body to contain %q", tt.wantBody)
+			}
+			for _, hide := range tt.hideBody {
+				if strings.Contains(body, hide) {
+					t.Errorf("want body not to contain %q", hide)
+				}
+			}
+		})
+	}
+}
+
+// TestBurnSnippet checks that a snippet to be burned after reading is deleted when first viewed
+// by someone other than its author
+func TestBurnSnippet(t *testing.T) {
+	app := newTestApplication(t)
+	server := newTestServer(t, app.routes(""))
+	defer server.Close()
+
+	// Alice creates a snippet to be burned after reading (checking the option is validated)
+	server.login(t, "alice@example.com", "validPa$$word")
+	_, _, body := server.get(t, "/snippet/create")
+	form := url.Values{}
+	form.Add("title", "Secret")
+	form.Add("content", "The password is swordfish")
+	form.Add("visibility", models.Unlisted)
+	form.Add("expires", "7d")
+	form.Add("burn", "yes")
+	form.Add("csrf_token", extractCSRFToken(t, []byte(body)))
+	if code, _, body := server.postForm(t, "/snippet/create", form); code != http.StatusOK || !bytes.Contains(body, []byte("This field is invalid")) {
+		t.Errorf("invalid burn option: want %d and error; got %d", http.StatusOK, code)
+	}
+	form.Set("burn", "true")
+	code, header, _ := server.postForm(t, "/snippet/create", form)
+	if code != http.StatusSeeOther {
+		t.Fatalf("want %d; got %d", http.StatusSeeOther, code)
+	}
+	path := header.Get("Location")
+
+	// The author can view it (and its history) as often as they like
+	for i := 0; i < 2; i++ {
+		code, _, body := server.get(t, path)
+		if code != http.StatusOK || !strings.Contains(body, "will be deleted when it is first viewed by someone else") {
+			t.Errorf("author view %d: want %d and notice; got %d", i+1, http.StatusOK, code)
+		}
+	}
+	if code, _, _ := server.get(t, path+"/history"); code != http.StatusOK {
+		t.Errorf("author history: want %d; got %d", http.StatusOK, code)
+	}
+
+	// Someone else can't get at it without burning it
+	reader := newTestServer(t, app.routes(""))
+	defer reader.Close()
+	for _, urlPath := range []string{path + "/history", path + "/diff"} {
+		if code, _, _ := reader.get(t, urlPath); code != http.StatusNotFound {
+			t.Errorf("%s: want %d; got %d", urlPath, http.StatusNotFound, code)
+		}
+	}
+	if code, header, _ := reader.get(t, "/snippet/2"); code != http.StatusMovedPermanently || header.Get("Location") != path {
+		t.Errorf("old link: want %d to %s; got %d to %s", http.StatusMovedPermanently, path, code, header.Get("Location"))
+	}
+
+	// The first view by someone else shows it then it's gone for everyone
+	code, _, body = reader.get(t, path)
+	if code != http.StatusOK {
+		t.Fatalf("first view: want %d; got %d", http.StatusOK, code)
+	}
+	for _, want := range []string{"The password is swordfish", "This snippet has now been deleted"} {
+		if !strings.Contains(body, want) {
+			t.Errorf("first view: want body to contain %q", want)
+		}
+	}
+	if strings.Contains(body, path+"/raw") {
+		t.Errorf("first view: want no link to the raw content")
+	}
+	if code, _, _ := reader.get(t, path); code != http.StatusNotFound {
+		t.Errorf("second view: want %d; got %d", http.StatusNotFound, code)
+	}
+	if code, _, _ := server.get(t, path); code != http.StatusNotFound {
+		t.Errorf("author view after burning: want %d; got %d", http.StatusNotFound, code)
+	}
+
+	// Reading the raw content also burns it
+	_, slug, err := app.snippets.Insert(1, "Raw secret", "swordfish", "", models.Unlisted, time.Now().AddDate(0, 0, 1), "", true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	code, header, body = reader.get(t, snippetURL(slug)+"/raw")
+	if code != http.StatusOK || body != "swordfish" || header.Get("Cache-Control") != "no-store" {
+		t.Errorf("raw: want %d %q no-store; got %d %q %s", http.StatusOK, "swordfish", code, body, header.Get("Cache-Control"))
+	}
+	if code, _, _ := reader.get(t, snippetURL(slug)+"/raw"); code != http.StatusNotFound {
+		t.Errorf("raw again: want %d; got %d", http.StatusNotFound, code)
+	}
+}
+
+// TestBurnSnippetRequests checks that HEAD requests don't burn a snippet and that a range request
+// doesn't burn it without sending all the content
+func TestBurnSnippetRequests(t *testing.T) {
+	app := newTestApplication(t)
+	server := newTestServer(t, app.routes(""))
+	defer server.Close()
+
+	// do sends a request with an optional Range header and returns the status and body
+	do := func(method, urlPath, rangeHeader string) (int, string) {
+		t.Helper()
+		request, err := http.NewRequest(method, server.URL+urlPath, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if rangeHeader != "" {
+			request.Header.Set("Range", rangeHeader)
+			request.Header.Set("If-None-Match", "*")
+		}
+		response, err := server.Client().Do(request)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer response.Body.Close()
+		body, err := io.ReadAll(response.Body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return response.StatusCode, string(body)
+	}
+
+	for _, urlPath := range []string{"", "/raw", "/download"} {
+		_, slug, err := app.snippets.Insert(1, "Secret", "swordfish", "", models.Unlisted, time.Now().AddDate(0, 0, 1), "", true)
+		if err != nil {
+			t.Fatal(err)
+		}
+		path := snippetURL(slug) + urlPath
+
+		// A HEAD request (eg from a link preview) gets nothing and leaves the snippet
+		if code, _ := do(http.MethodHead, path, ""); code != http.StatusNotFound {
+			t.Errorf("HEAD %s: want %d; got %d", path, http.StatusNotFound, code)
+		}
+		if s, err := app.snippets.GetBySlug(slug); err != nil || s == nil {
+			t.Fatalf("HEAD %s: want snippet not burned; got %v, %v", path, s, err)
+		}
+
+		// A range (or conditional) request is sent all the content as it's burned
+		code, body := do(http.MethodGet, path, "bytes=0-0")
+		if code != http.StatusOK || !strings.Contains(body, "swordfish") {
+			t.Errorf("GET %s range: want %d with all the content; got %d %q", path, http.StatusOK, code, body)
+		}
+		if code, _ := do(http.MethodGet, path, ""); code != http.StatusNotFound {
+			t.Errorf("GET %s again: want %d; got %d", path, http.StatusNotFound, code)
+		}
+	}
+}
+
+// TestProtectedSnippet checks that a snippet with a password can only be viewed after unlocking it
+func TestProtectedSnippet(t *testing.T) {
+	app := newTestApplication(t)
+	server := newTestServer(t, app.routes(""))
+	defer server.Close()
+
+	// Alice creates a snippet protected by a password (checking the password is validated)
+	server.login(t, "alice@example.com", "validPa$$word")
+	_, _, body := server.get(t, "/snippet/create")
+	form := url.Values{}
+	form.Add("title", "Locked")
+	form.Add("content", "The password is swordfish")
+	form.Add("expires", "7d")
+	form.Add("password", "short")
+	form.Add("csrf_token", extractCSRFToken(t, []byte(body)))
+	if code, _, body := server.postForm(t, "/snippet/create", form); code != http.StatusOK || !bytes.Contains(body, []byte("This field is too short")) {
+		t.Errorf("short password: want %d and error; got %d", http.StatusOK, code)
+	}
+	form.Set("password", "open sesame")
+	code, header, _ := server.postForm(t, "/snippet/create", form)
+	if code != http.StatusSeeOther {
+		t.Fatalf("want %d; got %d", http.StatusSeeOther, code)
+	}
+	path := header.Get("Location")
+
+	// The author doesn't need the password and it's not listed (even though it's public)
+	if code, _, body := server.get(t, path); code != http.StatusOK || !strings.Contains(body, "The password is swordfish") {
+		t.Errorf("author view: want %d and content; got %d", http.StatusOK, code)
+	}
+	if _, _, body := server.get(t, "/"); strings.Contains(body, "Locked") {
+		t.Errorf("home: want protected snippet not listed")
+	}
+
+	// Someone else is asked for the password and can't get the content any other way
+	reader := newTestServer(t, app.routes(""))
+	defer reader.Close()
+	code, _, body = reader.get(t, path)
+	if code != http.StatusOK || !strings.Contains(body, "Enter its password") || strings.Contains(body, "swordfish") {
+		t.Errorf("locked view: want %d and unlock form without content; got %d", http.StatusOK, code)
+	}
+	for _, urlPath := range []string{path + "/raw", path + "/download", path + "/history", path + "/diff"} {
+		if code, _, _ := reader.get(t, urlPath); code != http.StatusForbidden {
+			t.Errorf("locked %s: want %d; got %d", urlPath, http.StatusForbidden, code)
+		}
+	}
+	if code, header, _ := reader.get(t, "/snippet/2"); code != http.StatusMovedPermanently || header.Get("Location") != path {
+		t.Errorf("old link: want %d to %s; got %d to %s", http.StatusMovedPermanently, path, code, header.Get("Location"))
+	}
+
+	// A wrong password is rejected and the right one unlocks it for the rest of the session
+	unlock := url.Values{}
+	unlock.Add("password", "open says me")
+	unlock.Add("csrf_token", extractCSRFToken(t, []byte(body)))
+	if code, _, body := reader.postForm(t, path+"/unlock", unlock); code != http.StatusOK || !bytes.Contains(body, []byte("Incorrect password")) {
+		t.Errorf("wrong password: want %d and error; got %d", http.StatusOK, code)
+	}
+	unlock.Set("password", "open sesame")
+	if code, header, _ := reader.postForm(t, path+"/unlock", unlock); code != http.StatusSeeOther || header.Get("Location") != path {
+		t.Fatalf("right password: want %d to %s; got %d to %s", http.StatusSeeOther, path, code, header.Get("Location"))
+	}
+	if code, _, body := reader.get(t, path); code != http.StatusOK || !strings.Contains(body, "The password is swordfish") {
+		t.Errorf("unlocked view: want %d and content; got %d", http.StatusOK, code)
+	}
+	if code, _, body := reader.get(t, path+"/raw"); code != http.StatusOK || body != "The password is swordfish" {
+		t.Errorf("unlocked raw: want %d and content; got %d %q", http.StatusOK, code, body)
+	}
+}
+
+// TestDeleteSnippet checks that only the owner of a snippet can delete it
+func TestDeleteSnippet(t *testing.T) {
+	app := newTestApplication(t)
+	if _, err := app.users.Insert("Bob", "bob@example.com", "validPa$$word"); err != nil {
+		t.Fatal(err)
+	}
+	server := newTestServer(t, app.routes(""))
+	defer server.Close()
+	path := snippetPath(t, app, 1)
+
+	deleteAs := func(email string) int {
+		server.login(t, email, "validPa$$word")
+		_, _, body := server.get(t, "/")
+		form := url.Values{}
+		form.Add("csrf_token", extractCSRFToken(t, []byte(body)))
+		code, _, _ := server.postForm(t, path+"/delete", form)
+		return code
+	}
+
+	if code := deleteAs("bob@example.com"); code != http.StatusForbidden {
+		t.Errorf("want %d; got %d", http.StatusForbidden, code)
+	}
+	if code := deleteAs("alice@example.com"); code != http.StatusSeeOther {
+		t.Errorf("want %d; got %d", http.StatusSeeOther, code)
+	}
+	if code, _, _ := server.get(t, path); code != http.StatusNotFound {
+		t.Errorf("want %d; got %d", http.StatusNotFound, code)
+	}
+}
@@ -2,11 +2,19 @@ package main
 
 import (
 	"bytes"
+	"crypto/sha256"
 	"fmt"
+	"io"
+	"mime"
 	"net/http"
+	"net/url"
 	"runtime/debug"
+	"strconv"
+	"strings"
 	"time"
+	"unicode"
 
+	"github.com/andrewwphillips/snippetbox/pkg/forms"
 	"github.com/andrewwphillips/snippetbox/pkg/models"
 	"github.com/justinas/nosurf"
 )
@@ -84,3 +92,305 @@ func (app *application) authenticatedUser(r *http.Request) *models.User {
 	}
 	return user
 }
+
+// renderProfile displays the profile page with one of its forms (eg with errors).  The name and email
+// fields are filled in with the user's current details unless they were submitted in the form.
+func (app *application) renderProfile(w http.ResponseWriter, r *http.Request, form *forms.Form) {
+	user := app.authenticatedUser(r)
+	for field, value := range map[string]string{"name": user.Name, "email": user.Email} {
+		if _, ok := form.Values[field]; !ok {
+			form.Set(field, value)
+		}
+	}
+	app.render(w, r, "profile.page.tmpl", &templateData{Form: form})
+}
+
+// userID returns the ID of the current user or zero if nobody is logged in
+func (app *application) userID(r *http.Request) int {
+	if user := app.authenticatedUser(r); user != nil {
+		return user.ID
+	}
+	return 0
+}
+
+// ownedSnippet returns the snippet that the current user is allowed to change (see requireSnippetOwner)
+func (app *application) ownedSnippet(r *http.Request) *models.Snippet {
+	s, ok := r.Context().Value(contextKeySnippet).(*models.Snippet)
+	if !ok {
+		return nil
+	}
+	return s
+}
+
+// findSnippet gets the snippet given by ":slug" in the URL.  If not found, not visible to the current
+// user (see models.Snippet.VisibleTo) or there is an error the response has been written and it
+// returns nil.  If the snippet's content is shown it must first be passed to burnSnippet.
+func (app *application) findSnippet(w http.ResponseWriter, r *http.Request) *models.Snippet {
+	s, err := app.snippets.GetBySlug(r.URL.Query().Get(":slug"))
+	if err != nil {
+		app.serverError(w, err)
+		return nil
+	}
+	if s == nil || !s.VisibleTo(app.userID(r)) {
+		app.notFound(w) // private snippets are hidden from everyone but the owner
+		return nil
+	}
+	return s
+}
+
+// startSession logs in a user and returns the page they were trying to reach before logging in
+// (see requireAuthenticatedUser), or the home page.  Anything else in the session from before logging
+// in is removed to prevent session fixation.  (The session is kept, encrypted, in a cookie rather
+// than being looked up using a session ID that could be renewed, but removing the data gives the
+// cookie a new value and means nothing planted in it before logging in is trusted afterwards.)
+func (app *application) startSession(r *http.Request, user *models.User) string {
+	next := app.session.GetString(r, sessionAfterLogin)
+	for _, key := range app.session.Keys(r) {
+		app.session.Remove(r, key)
+	}
+	app.session.Put(r, sessionUserID, user.ID)
+	app.session.Put(r, sessionVersion, user.SessionVersion) // see authenticate
+
+	if !localPath(next) {
+		return "/"
+	}
+	return next
+}
+
+// localPath returns true if a URL is a path on this site (such as "/snippet/create?x=1") so that it's
+// safe to redirect to.  URLs with a scheme or host (including "//host/path") are not allowed so that
+// users can't be sent to another site.
+func localPath(s string) bool {
+	if !strings.HasPrefix(s, "/") || strings.HasPrefix(s, "//") || strings.HasPrefix(s, "/\\") {
+		return false // browsers treat /\host like //host
+	}
+	u, err := url.Parse(s)
+	return err == nil && u.Scheme == "" && u.Host == "" && u.User == nil
+}
+
+// acceptsHTML returns true if a request is from a browser (that wants an HTML page) rather than
+// eg an API client or a script
+func acceptsHTML(r *http.Request) bool {
+	return strings.Contains(r.Header.Get("Accept"), "text/html")
+}
+
+// maxUnlocked is the most protected snippets that are remembered as unlocked (the session is
+// stored in a cookie so can't grow forever)
+const maxUnlocked = 50
+
+// unlocked returns true if the current user can view a snippet (s) without giving its password,
+// ie it's not protected, it's their snippet or they have unlocked it (see addUnlocked)
+func (app *application) unlocked(r *http.Request, s *models.Snippet) bool {
+	if !s.Protected || s.OwnedBy(app.userID(r)) {
+		return true
+	}
+	ids, _ := app.session.Get(r, sessionUnlocked).([]int)
+	for _, id := range ids {
+		if id == s.ID {
+			return true
+		}
+	}
+	return false
+}
+
+// addUnlocked records in the session that the current user has given the password of a snippet (ID)
+func (app *application) addUnlocked(r *http.Request, snippetID int) {
+	ids, _ := app.session.Get(r, sessionUnlocked).([]int)
+	ids = append(ids, snippetID)
+	if len(ids) > maxUnlocked {
+		ids = ids[len(ids)-maxUnlocked:] // forget the oldest
+	}
+	app.session.Put(r, sessionUnlocked, ids)
+}
+
+// unlockedSnippet is like findSnippet but sends a 403 (Forbidden) response, and returns nil, if the
+// snippet is protected by a password that the current user has not given (see unlocked)
+func (app *application) unlockedSnippet(w http.ResponseWriter, r *http.Request) *models.Snippet {
+	s := app.findSnippet(w, r)
+	if s != nil && !app.unlocked(r, s) {
+		app.clientError(w, http.StatusForbidden)
+		return nil
+	}
+	return s
+}
+
+// urlSnippet is like unlockedSnippet but snippets to be burned after reading are only found for their
+// author.  It's used for pages (eg history) that are not the way to read the snippet.
+func (app *application) urlSnippet(w http.ResponseWriter, r *http.Request) *models.Snippet {
+	s := app.unlockedSnippet(w, r)
+	if s != nil && s.BurnAfterReading && !s.OwnedBy(app.userID(r)) {
+		app.notFound(w)
+		return nil
+	}
+	return s
+}
+
+// burnSnippet deletes a snippet (s) that is to be burned after reading, unless the current user
+// is its author, and returns it.  If it has already been burned (eg by a concurrent request) or
+// there is an error the response has been written and it returns nil.  It also returns nil if s
+// is nil (so it can be passed the result of findSnippet or unlockedSnippet).  Only GET requests
+// burn a snippet - other requests (eg HEAD from link previews, which pat also routes to GET handlers)
+// get a 404 (Not Found) response as the snippet can't be sent without burning it.
+func (app *application) burnSnippet(w http.ResponseWriter, r *http.Request, s *models.Snippet) *models.Snippet {
+	if s == nil || !s.BurnAfterReading || s.OwnedBy(app.userID(r)) {
+		return s
+	}
+	if r.Method != http.MethodGet {
+		app.notFound(w)
+		return nil
+	}
+
+	burned, err := app.snippets.Burn(s.ID)
+	if err != nil {
+		app.serverError(w, err)
+		return nil
+	}
+	if burned == nil {
+		app.notFound(w) // someone else read it first
+		return nil
+	}
+	return burned
+}
+
+// snippetsPerPage is the number of snippets listed on each page of the home and search pages
+const snippetsPerPage = 10
+
+// snippetPage uses page (eg SnippetStore.Page) to get the page of snippets at the cursor given by the
+// "before" (older snippets) or "after" (newer) query parameter, or the first page if neither is given.
+// The links to the pages either side (see pages.partial.tmpl) start with prefix, eg "/snippets?".
+// If there is an error the response has been written and it returns nil.
+func (app *application) snippetPage(w http.ResponseWriter, r *http.Request, prefix string,
+	page func(models.Cursor, int) ([]*models.Snippet, error)) *templateData {
+	var cursor models.Cursor // zero for the latest snippets
+	var err error
+	if before := r.URL.Query().Get("before"); before != "" {
+		cursor, err = parseCursor(before)
+	} else if after := r.URL.Query().Get("after"); after != "" {
+		cursor, err = parseCursor(after)
+		cursor.Newer = true
+	}
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return nil
+	}
+
+	// Get one extra snippet to find out if there is another page
+	ss, err := page(cursor, snippetsPerPage+1)
+	if err == nil && cursor.Newer && len(ss) <= snippetsPerPage {
+		// Got back to the start so show a full page of the latest snippets
+		cursor = models.Cursor{}
+		ss, err = page(cursor, snippetsPerPage+1)
+	}
+	if err != nil {
+		app.serverError(w, err)
+		return nil
+	}
+
+	more := len(ss) > snippetsPerPage
+	if more && cursor.Newer {
+		ss = ss[1:] // the extra snippet is the newest
+	} else if more {
+		ss = ss[:snippetsPerPage]
+	}
+
+	// Add links to the pages either side of this one
+	td := &templateData{Snippets: ss}
+	if len(ss) > 0 {
+		if cursor.Newer && more || !cursor.Newer && cursor.ID != 0 {
+			td.PrevPage = prefix + "after=" + formatCursor(ss[0])
+		}
+		if cursor.Newer || more {
+			td.NextPage = prefix + "before=" + formatCursor(ss[len(ss)-1])
+		}
+	}
+	return td
+}
+
+// snippetURL returns the path of the page showing a snippet (given its slug)
+func snippetURL(slug string) string {
+	return "/s/" + slug
+}
+
+// formatCursor returns the position of a snippet as a string (for a URL) to get the next
+// or previous page of snippets - the creation time (in nanoseconds) and ID
+func formatCursor(s *models.Snippet) string {
+	return strconv.FormatInt(s.Created.UnixNano(), 10) + "-" + strconv.Itoa(s.ID)
+}
+
+// parseCursor converts a string created by formatCursor back to a models.Cursor
+func parseCursor(str string) (models.Cursor, error) {
+	created, id, found := strings.Cut(str, "-")
+	if !found {
+		return models.Cursor{}, fmt.Errorf("invalid cursor %q", str)
+	}
+	nano, err := strconv.ParseInt(created, 10, 64)
+	if err != nil {
+		return models.Cursor{}, err
+	}
+	cursor := models.Cursor{Created: time.Unix(0, nano).UTC()}
+	if cursor.ID, err = strconv.Atoi(id); err != nil || cursor.ID < 1 {
+		return models.Cursor{}, fmt.Errorf("invalid cursor %q", str)
+	}
+	return cursor, nil
+}
+
+// formLanguage returns the language chosen in the "language" field of a snippet form, detecting
+// it from the "content" field if "auto" was chosen.  The form must have been validated.
+func formLanguage(form *forms.Form) string {
+	if lang := form.Get("language"); lang != "auto" {
+		return lang
+	}
+	return detectLanguage(form.Get("content"))
+}
+
+// formVisibility gets the visibility of a snippet from a (validated) form - public if not given
+func formVisibility(form *forms.Form) string {
+	if v := form.Get("visibility"); v != "" {
+		return v
+	}
+	return models.Public
+}
+
+// serveSnippetContent sends the content of a snippet as plain text.  The disposition is "inline"
+// (display in the browser) or "attachment" (save to a file named using snippetFilename).
+// Browsers must revalidate (using the ETag) before using a cached copy as the snippet may have
+// been edited or deleted, and the response is private as it may depend on who is logged in.
+func serveSnippetContent(w http.ResponseWriter, r *http.Request, s *models.Snippet, disposition string) {
+	h := w.Header()
+	h.Set("Content-Type", "text/plain; charset=utf-8")
+	h.Set("X-Content-Type-Options", "nosniff") // stop browsers treating the content as HTML
+	h.Set("Content-Disposition", mime.FormatMediaType(disposition,
+		map[string]string{"filename": snippetFilename(s)}))
+	if s.BurnAfterReading {
+		// Send all the content (ignoring any range or conditional request) as it may have just been burned
+		h.Set("Cache-Control", "no-store") // don't keep a copy of a secret
+		h.Set("Content-Length", strconv.Itoa(len(s.Content)))
+		io.WriteString(w, s.Content)
+		return
+	}
+	h.Set("Cache-Control", "private, no-cache")
+	h.Set("ETag", fmt.Sprintf(`"%x"`, sha256.Sum256([]byte(s.Title+"\x00"+s.Language+"\x00"+s.Content))))
+
+	// ServeContent handles conditional (If-None-Match) and range requests
+	http.ServeContent(w, r, "", time.Time{}, strings.NewReader(s.Content))
+}
+
+// maxFilenameLength is the maximum length (in runes, excluding the extension) of snippetFilename
+const maxFilenameLength = 50
+
+// snippetFilename makes a file name for a snippet from its title and language, eg a Go snippet
+// titled "Hello, World!" gives "hello-world.go".  Runs of characters other than letters and
+// digits become a single hyphen.  If the title has no letters or digits "snippet-<id>" is used.
+func snippetFilename(s *models.Snippet) string {
+	words := strings.FieldsFunc(strings.ToLower(s.Title), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	name := []rune(strings.Join(words, "-"))
+	if len(name) > maxFilenameLength {
+		name = []rune(strings.TrimRight(string(name[:maxFilenameLength]), "-"))
+	}
+	if len(name) == 0 {
+		return fmt.Sprintf("snippet-%d%s", s.ID, languageExt(s.Language))
+	}
+	return string(name) + languageExt(s.Language)
+}
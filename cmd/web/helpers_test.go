@@ -0,0 +1,58 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/andrewwphillips/snippetbox/pkg/models"
+)
+
+// TestSnippetFilename checks the names of files that snippets are downloaded to
+func TestSnippetFilename(t *testing.T) {
+	tests := []struct {
+		name     string
+		snippet  models.Snippet
+		wantName string
+	}{
+		{"Plain text", models.Snippet{ID: 1, Title: "An old silent pond"}, "an-old-silent-pond.txt"},
+		{"Language", models.Snippet{ID: 1, Title: "Hello, World!", Language: "go"}, "hello-world.go"},
+		{"Punctuation", models.Snippet{ID: 1, Title: "  --C++ & C#--  ", Language: "cpp"}, "c-c.cpp"},
+		{"Unicode", models.Snippet{ID: 1, Title: "Über Café", Language: "sql"}, "über-café.sql"},
+		{"No letters", models.Snippet{ID: 42, Title: "!!!", Language: "bash"}, "snippet-42.sh"},
+		{"Unknown language", models.Snippet{ID: 1, Title: "x", Language: "cobol"}, "x.txt"},
+		{"Long", models.Snippet{ID: 1, Title: strings.Repeat("a", 49) + " b"}, strings.Repeat("a", 49) + ".txt"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := snippetFilename(&tt.snippet); got != tt.wantName {
+				t.Errorf("want %q; got %q", tt.wantName, got)
+			}
+		})
+	}
+}
+
+// TestLocalPath checks that only paths on this site are allowed as redirects after logging in
+func TestLocalPath(t *testing.T) {
+	tests := []struct {
+		url  string
+		want bool
+	}{
+		{"/", true},
+		{"/snippet/create", true},
+		{"/user/snippets?before=x#top", true},
+		{"", false},
+		{"snippet/create", false},
+		{"//evil.example.com/", false},
+		{"/\\evil.example.com/", false},
+		{"https://evil.example.com/", false},
+		{"javascript:alert(1)", false},
+		{"/%zz", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.url, func(t *testing.T) {
+			if got := localPath(tt.url); got != tt.want {
+				t.Errorf("want %v; got %v", tt.want, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"html/template"
+	"strings"
+
+	"github.com/alecthomas/chroma/v2"
+	"github.com/alecthomas/chroma/v2/formatters/html"
+	"github.com/alecthomas/chroma/v2/lexers"
+	"github.com/alecthomas/chroma/v2/styles"
+)
+
+// language is a programming (or other) language that a snippet can be written in
+type language struct {
+	Name  string // the chroma lexer name (alias) saved with the snippet, eg "go"
+	Label string // the name displayed to users, eg "Go"
+	Ext   string // file name extension used when a snippet is downloaded, eg ".go"
+}
+
+// languages are those that can be chosen for a snippet (in the order they are listed)
+var languages = []language{
+	{"bash", "Bash", ".sh"},
+	{"c", "C", ".c"},
+	{"cpp", "C++", ".cpp"},
+	{"csharp", "C#", ".cs"},
+	{"css", "CSS", ".css"},
+	{"docker", "Dockerfile", ".dockerfile"},
+	{"go", "Go", ".go"},
+	{"html", "HTML", ".html"},
+	{"java", "Java", ".java"},
+	{"javascript", "JavaScript", ".js"},
+	{"json", "JSON", ".json"},
+	{"kotlin", "Kotlin", ".kt"},
+	{"markdown", "Markdown", ".md"},
+	{"php", "PHP", ".php"},
+	{"python", "Python", ".py"},
+	{"ruby", "Ruby", ".rb"},
+	{"rust", "Rust", ".rs"},
+	{"sql", "SQL", ".sql"},
+	{"swift", "Swift", ".swift"},
+	{"typescript", "TypeScript", ".ts"},
+	{"yaml", "YAML", ".yaml"},
+}
+
+// languageNames returns the names of all the languages (eg for forms.PermittedValues)
+func languageNames() []string {
+	names := make([]string, 0, len(languages))
+	for _, lang := range languages {
+		names = append(names, lang.Name)
+	}
+	return names
+}
+
+// languageLabel returns the name to display for a language or "Plain text" if it's not known
+func languageLabel(name string) string {
+	for _, lang := range languages {
+		if lang.Name == name {
+			return lang.Label
+		}
+	}
+	return "Plain text"
+}
+
+// languageExt returns the file name extension for a language or ".txt" if it's not known
+func languageExt(name string) string {
+	for _, lang := range languages {
+		if lang.Name == name {
+			return lang.Ext
+		}
+	}
+	return ".txt"
+}
+
+// detectLanguage guesses the language of some code, returning an empty string if the language
+// is not one of those listed in languages.  Note that only some lexers can recognise their
+// language (eg from a "#!/bin/bash" line) so this often finds nothing.
+func detectLanguage(content string) string {
+	lexer := lexers.Analyse(content)
+	if lexer == nil {
+		return ""
+	}
+	for _, lang := range languages {
+		if l := lexers.Get(lang.Name); l != nil && l.Config().Name == lexer.Config().Name {
+			return lang.Name
+		}
+	}
+	return ""
+}
+
+// codeFormatter generates HTML (with line numbers) using inline styles so that no extra CSS is needed
+var codeFormatter = html.New(html.WithLineNumbers(true), html.TabWidth(4))
+
+// codeStyle is the colour scheme of highlighted code
+var codeStyle = styles.Get("github")
+
+// highlightCode returns the HTML for displaying content (in a <pre> element) with syntax
+// highlighting for the language and line numbers.  If language is empty (or not known) the
+// content is displayed as plain text.
+func highlightCode(language, content string) (template.HTML, error) {
+	lexer := lexers.Fallback // plain text
+	if language != "" {
+		if l := lexers.Get(language); l != nil {
+			lexer = l
+		}
+	}
+
+	tokens, err := chroma.Coalesce(lexer).Tokenise(nil, content)
+	if err != nil {
+		return "", err
+	}
+	var b strings.Builder
+	if err = codeFormatter.Format(&b, codeStyle, tokens); err != nil {
+		return "", err
+	}
+	return template.HTML(b.String()), nil
+}
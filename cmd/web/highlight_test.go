@@ -0,0 +1,72 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/alecthomas/chroma/v2/lexers"
+)
+
+// TestLanguages checks that there is a chroma lexer for every language that can be chosen
+func TestLanguages(t *testing.T) {
+	for _, lang := range languages {
+		if lexers.Get(lang.Name) == nil {
+			t.Errorf("no lexer for %q", lang.Name)
+		}
+		if got := languageLabel(lang.Name); got != lang.Label {
+			t.Errorf("languageLabel(%q): want %q; got %q", lang.Name, lang.Label, got)
+		}
+	}
+	if got := languageLabel(""); got != "Plain text" {
+		t.Errorf("languageLabel(\"\"): want %q; got %q", "Plain text", got)
+	}
+}
+
+// TestDetectLanguage checks that the language of some snippets is recognised
+func TestDetectLanguage(t *testing.T) {
+	tests := map[string]struct {
+		content string
+		want    string
+	}{
+		"Bash":       {"#!/bin/bash\necho hello\n", "bash"},
+		"Go":         {"package main\n\nimport \"fmt\"\n\nfunc main() {\n\tfmt.Println(1)\n}\n", "go"},
+		"Plain text": {"An old silent pond...", ""},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			if got := detectLanguage(tt.content); got != tt.want {
+				t.Errorf("want %q; got %q", tt.want, got)
+			}
+		})
+	}
+}
+
+// TestHighlightCode checks that code is highlighted with line numbers and that the content is escaped
+func TestHighlightCode(t *testing.T) {
+	tests := map[string]struct {
+		language, content string
+		want              []string
+	}{
+		"Go": {"go", "package main\n\nvar s = \"<b>\"\n", []string{
+			"<pre", ">package</span> main", ">3</span>", "&#34;&lt;b&gt;&#34;",
+		}},
+		"Plain text": {"", "<script>alert(1)</script>", []string{"&lt;script&gt;alert(1)&lt;/script&gt;"}},
+		"Unknown":    {"cobol-2099", "a < b", []string{"a &lt; b"}},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			got, err := highlightCode(tt.language, tt.content)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, want := range tt.want {
+				if !strings.Contains(string(got), want) {
+					t.Errorf("want %q in %s", want, got)
+				}
+			}
+			if strings.Contains(string(got), "<script>") || strings.Contains(string(got), "<b>") {
+				t.Errorf("content not escaped: %s", got)
+			}
+		})
+	}
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/andrewwphillips/snippetbox/pkg/mailer"
+	"github.com/andrewwphillips/snippetbox/pkg/models"
+)
+
+// How long the links in emails can be used
+const (
+	verifyLifetime = 48 * time.Hour // verify an email address (see sendVerifyEmail)
+	resetLifetime  = time.Hour      // reset a password (see sendResetEmail)
+)
+
+// sendVerifyEmail emails a link to a user that verifies their email address (see verifyUser)
+func (app *application) sendVerifyEmail(user *models.User) error {
+	token, err := app.users.NewToken(user.ID, models.TokenVerify, verifyLifetime)
+	if err != nil {
+		return err
+	}
+
+	return app.mailer.Send(mailer.Message{
+		To:      user.Email,
+		Subject: "Verify your Snippetbox email address",
+		Body: fmt.Sprintf("Hello %s,\n\n"+
+			"Please open this link to verify your email address so you can create snippets:\n\n"+
+			"%s/user/verify/%s\n\n"+
+			"The link expires in %d hours. If you didn't sign up to Snippetbox you can ignore this email.\n",
+			user.Name, app.baseURL, token, int(verifyLifetime.Hours())),
+	})
+}
+
+// sendResetEmail emails a link to a user that lets them set a new password (see resetPassword)
+func (app *application) sendResetEmail(user *models.User) error {
+	token, err := app.users.NewToken(user.ID, models.TokenReset, resetLifetime)
+	if err != nil {
+		return err
+	}
+
+	return app.mailer.Send(mailer.Message{
+		To:      user.Email,
+		Subject: "Reset your Snippetbox password",
+		Body: fmt.Sprintf("Hello %s,\n\n"+
+			"Please open this link to choose a new password:\n\n"+
+			"%s/user/reset/%s\n\n"+
+			"The link expires in %d minutes and can only be used once. If you didn't ask to reset your "+
+			"password you can ignore this email.\n",
+			user.Name, app.baseURL, token, int(resetLifetime.Minutes())),
+	})
+}
@@ -1,17 +1,25 @@
 package main
 
 import (
+	"context"
 	"crypto/tls"
 	"flag"
 	"html/template"
 	"log"
 	"net/http"
 	"os"
+	"os/signal"
+	"strings"
+	"syscall"
 	"time"
 
+	"github.com/andrewwphillips/snippetbox/pkg/forms"
+	"github.com/andrewwphillips/snippetbox/pkg/mailer"
 	"github.com/andrewwphillips/snippetbox/pkg/models"
-	"github.com/andrewwphillips/snippetbox/pkg/models/mysql"
-	_ "github.com/go-sql-driver/mysql"
+	_ "github.com/andrewwphillips/snippetbox/pkg/models/memory"   // registers the "memory" store
+	_ "github.com/andrewwphillips/snippetbox/pkg/models/mysql"    // registers the "mysql" store
+	_ "github.com/andrewwphillips/snippetbox/pkg/models/postgres" // registers the "postgres" store
+	_ "github.com/andrewwphillips/snippetbox/pkg/models/sqlite"   // registers the "sqlite" store
 	"github.com/golangcollege/sessions"
 )
 
@@ -19,19 +27,12 @@ import (
 type application struct {
 	infoLog, errorLog *log.Logger // INFO (stdout) and ERROR (stderr) loggers
 	session           *sessions.Session
-	snippets          interface {
-		Insert(string, string, string) (int, error)
-		Get(int) (*models.Snippet, error)
-		Latest() ([]*models.Snippet, error)
-		Close()
-	}
-	templateCache map[string]*template.Template
-	users         interface {
-		Insert(string, string, string) (int, error)
-		Authenticate(string, string) (int, string, error)
-		Get(int) (*models.User, error)
-		Close()
-	}
+	snippets          models.SnippetStore
+	templateCache     map[string]*template.Template
+	users             models.UserStore
+	maxExpiry         time.Duration // longest a snippet can be kept (0 = no maximum, so snippets can be kept for ever)
+	mailer            mailer.Mailer // sends emails to users (eg to verify their address)
+	baseURL           string        // scheme and host of links in emails, eg "https://snippetbox.example.com"
 }
 
 // main is the program entry point
@@ -39,20 +40,51 @@ func main() {
 	// Get command line options and initialise the app struct
 	root := flag.String("static-dir", "./ui/static/", "Path to static assets")
 	addr := flag.String("addr", ":4000", "HTTP network address")
-	dsn := flag.String("dsn", "web:pass@/snippetbox", "MySQL data source name")
+	store := flag.String("store", "mysql", "Storage backend - one of: "+strings.Join(models.Backends(), ", "))
+	dsn := flag.String("dsn", "web:pass@/snippetbox", "Data source name for the storage backend")
 	secret := flag.String("secret", "s6Ndh+pPbnzHbS*+9Pk8qGWhTzbpa@ge", "Secret key")
+	purgeInterval := flag.Duration("purge-interval", time.Hour, "How often to delete expired snippets (0 = never)")
+	purgeBatch := flag.Int("purge-batch", 1000, "Maximum expired snippets deleted in one go")
+	mailURL := flag.String("mailer", "stdout", "Where emails are sent - smtp://[user:password@]host[:port], file:path or stdout")
+	mailFrom := flag.String("mail-from", "snippetbox@localhost", "Email address that emails are sent from")
+	baseURL := flag.String("base-url", "https://localhost:4000", "Scheme and host of the server used in links in emails")
+	var maxExpiry time.Duration
+	flag.Func("max-expiry", "Longest time snippets can be kept, eg 30d or 12h (default no maximum)", func(s string) (err error) {
+		maxExpiry, err = forms.ParseDuration(s)
+		return err
+	})
 	flag.Parse()
 
+	// The "migrate" command updates the database tables rather than running the server
+	if flag.Arg(0) == "migrate" {
+		if err := runMigrate(*store, *dsn, flag.Args()[1:], os.Stdout); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
 	app := application{
 		templateCache: newTemplateCache("./ui/html/"),
 		infoLog:       log.New(os.Stdout, "INFO\t", log.Ldate|log.Ltime),
 		errorLog:      log.New(os.Stderr, "ERROR\t", log.Ldate|log.Ltime|log.Lshortfile),
-		snippets:      mysql.NewSnippetModel(*dsn),
-		users:         mysql.NewUserModel(*dsn),
 		session:       sessions.New([]byte(*secret)),
+		maxExpiry:     maxExpiry,
+		baseURL:       strings.TrimSuffix(*baseURL, "/"),
+	}
+
+	// Open the snippets and users stores using the selected backend
+	var err error
+	app.snippets, app.users, err = models.Open(*store, *dsn)
+	if err != nil {
+		app.errorLog.Fatal(err)
 	}
 	defer app.snippets.Close()
 	defer app.users.Close()
+	app.mailer, err = mailer.Open(*mailURL, *mailFrom)
+	if err != nil {
+		app.errorLog.Fatal(err)
+	}
+	defer app.mailer.Close()
 	app.session.Lifetime = 12 * time.Hour // sessions expire after 12 hours
 	app.session.Secure = true
 
@@ -95,5 +127,27 @@ func main() {
 	// NOTE: ListenAndServeTLS params (TLS private key and certificate files) were generated using this command line:
 	// > go run /c/progra~1/go1.19/src/crypto/tls/generate_cert.go --ecdsa-curve P256 --host=localhost
 
-	app.errorLog.Fatal(server.ListenAndServeTLS("./tls/cert.pem", "./tls/key.pem"))
+	// Delete expired snippets in the background while the server is running
+	stopReaper := app.startReaper(*purgeInterval, *purgeBatch)
+
+	// Shut down gracefully (letting requests in progress complete) on Ctrl-C or SIGTERM
+	shutdownErr := make(chan error, 1)
+	go func() {
+		quit := make(chan os.Signal, 1)
+		signal.Notify(quit, os.Interrupt, syscall.SIGTERM)
+		app.infoLog.Println("Shutting down server:", <-quit)
+
+		ctx, cancel := context.WithTimeout(context.Background(), 20*time.Second)
+		defer cancel()
+		shutdownErr <- server.Shutdown(ctx)
+	}()
+
+	if err = server.ListenAndServeTLS("./tls/cert.pem", "./tls/key.pem"); err != http.ErrServerClosed {
+		app.errorLog.Fatal(err)
+	}
+	if err = <-shutdownErr; err != nil {
+		app.errorLog.Println(err)
+	}
+	stopReaper()
+	app.infoLog.Println("Server stopped")
 }
@@ -15,14 +15,20 @@ type contextKey string
 
 // contextKeyUser is the key used with response context to obtain the current user
 const (
-	sessionUserID  = "userID"           // key for user ID stored in the session (cookie?)
-	contextKeyUser = contextKey("user") // key for user details stored in the context.Context
+	sessionUserID     = "userID"              // key for user ID stored in the session (cookie?)
+	sessionUnlocked   = "unlocked"            // key for IDs of protected snippets unlocked in the session (see addUnlocked)
+	sessionAfterLogin = "afterLogin"          // key for the page the user was trying to reach before logging in (or signing up)
+	sessionVersion    = "sessionVersion"      // key for the user's SessionVersion when they logged in (see authenticate)
+	contextKeyUser    = contextKey("user")    // key for user details stored in the context.Context
+	contextKeySnippet = contextKey("snippet") // key for the snippet (checked by requireSnippetOwner) in the context
 )
 
 // authenticate adds middleware that checks for the session "userID" and (if found)
 // looks the user in the "Users" table and adds it to the request context using the
 // custom context key contextKeyUser.  If the session has a "userID" but there is no
-// DB record for the user then the session "userID" is removed
+// DB record for the user then the session "userID" is removed.  The user is also logged
+// out if their SessionVersion has changed since they logged in (eg their password was
+// reset) as sessions are kept in cookies so can't be deleted on the server.
 func (app *application) authenticate(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		// Check is user is logged in
@@ -36,9 +42,11 @@ func (app *application) authenticate(next http.Handler) http.Handler {
 		if err != nil {
 			app.serverError(w, err)
 			return
-		} else if user == nil { // err == nil and user == nil means not found
-			// user must have been removed so log them out and continue (no auth)
+		} else if user == nil || user.SessionVersion != app.session.GetInt(r, sessionVersion) {
+			// user must have been removed (err == nil and user == nil means not found) or the
+			// session ended, so log them out and continue (no auth)
 			app.session.Remove(r, sessionUserID)
+			app.session.Remove(r, sessionVersion)
 			next.ServeHTTP(w, r)
 			return
 		}
@@ -49,15 +57,37 @@ func (app *application) authenticate(next http.Handler) http.Handler {
 	})
 }
 
-// requireAuthenticatedUser blocks requests unless the user is logged in
+// requireAuthenticatedUser blocks requests unless the user is logged in.  Browsers are sent to the
+// login page (and then back to the page they asked for - see startSession) but other clients, such
+// as scripts and API clients, just get a 401 (Unauthorized) response.
 func (app *application) requireAuthenticatedUser(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		// If not logged in redirect to the login page (and don't call next.ServeHTTP)
 		if app.authenticatedUser(r) == nil {
-			// REFACTOR:I replaced the following line (which just sends the user
-			// back to the login page) with an auth error response
-			//http.Redirect(w, r, "/user/login", http.StatusFound)
-			http.Error(w, "Not logged in", http.StatusUnauthorized)
+			if !acceptsHTML(r) {
+				http.Error(w, "Not logged in", http.StatusUnauthorized)
+				return
+			}
+			// Remember the page so the user can be sent back to it (a form that was posted can't be)
+			if r.Method == http.MethodGet {
+				app.session.Put(r, sessionAfterLogin, r.URL.RequestURI())
+			}
+			app.session.Put(r, "flash", "Please log in first.")
+			http.Redirect(w, r, "/user/login", http.StatusSeeOther)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// requireVerifiedUser blocks requests unless the user has verified their email address (see
+// verifyUser) instead showing a page that lets them resend the verification email.  It must come
+// after requireAuthenticatedUser in the chain.
+func (app *application) requireVerifiedUser(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if user := app.authenticatedUser(r); user == nil || !user.Verified {
+			app.render(w, r, "verify.page.tmpl", &templateData{})
 			return
 		}
 
@@ -65,6 +95,30 @@ func (app *application) requireAuthenticatedUser(next http.Handler) http.Handler
 	})
 }
 
+// requireSnippetOwner blocks requests for a snippet (given by ":slug" in the URL) unless the
+// current user created it.  It must come after requireAuthenticatedUser in the chain.
+// The snippet is added to the request context (see ownedSnippet) to save getting it again.
+func (app *application) requireSnippetOwner(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s, err := app.snippets.GetBySlug(r.URL.Query().Get(":slug"))
+		if err != nil {
+			app.serverError(w, err)
+			return
+		}
+		if s == nil || !s.VisibleTo(app.userID(r)) {
+			app.notFound(w)
+			return
+		}
+		if user := app.authenticatedUser(r); user == nil || user.ID != s.UserID {
+			app.clientError(w, http.StatusForbidden) // someone else's snippet
+			return
+		}
+
+		ctx := context.WithValue(r.Context(), contextKeySnippet, s)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
 // logRequest logs all requests to stdout
 func (app *application) logRequest(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/andrewwphillips/snippetbox/pkg/migrate"
+)
+
+// migrateUsage describes the command line for the migrate command
+const migrateUsage = "usage: web [flags] migrate up|down|status"
+
+// runMigrate implements the migrate command which creates or updates the tables
+// of the storage backend (store) using the migrations embedded in the program
+//   - "up" applies all outstanding migrations
+//   - "down" reverts the last applied migration
+//   - "status" lists all migrations and when they were applied
+func runMigrate(store, dsn string, args []string, out io.Writer) error {
+	if len(args) != 1 {
+		return errors.New(migrateUsage)
+	}
+
+	m, err := migrate.Open(store, dsn)
+	if err != nil {
+		return err
+	}
+	defer m.Close()
+
+	switch args[0] {
+	case "up":
+		applied, err := m.Up()
+		for _, migration := range applied {
+			fmt.Fprintf(out, "applied %04d_%s\n", migration.Version, migration.Name)
+		}
+		if err != nil {
+			return err
+		}
+		if len(applied) == 0 {
+			fmt.Fprintln(out, "no migrations to apply")
+		}
+
+	case "down":
+		reverted, err := m.Down()
+		if err != nil {
+			return err
+		}
+		if reverted == nil {
+			fmt.Fprintln(out, "no migrations to revert")
+		} else {
+			fmt.Fprintf(out, "reverted %04d_%s\n", reverted.Version, reverted.Name)
+		}
+
+	case "status":
+		status, err := m.Status()
+		if err != nil {
+			return err
+		}
+		for _, s := range status {
+			applied := "pending"
+			if !s.Applied.IsZero() {
+				applied = "applied " + humanDate(s.Applied)
+			}
+			fmt.Fprintf(out, "%04d_%-30s %s\n", s.Version, s.Name, applied)
+		}
+
+	default:
+		return errors.New(migrateUsage)
+	}
+	return nil
+}
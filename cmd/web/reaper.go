@@ -0,0 +1,64 @@
+package main
+
+import (
+	"time"
+)
+
+// startReaper starts a goroutine that deletes expired snippets from the store every interval.
+// Snippets are deleted in batches (of up to batch snippets) to avoid locking the table for
+// long periods.  It returns a function that stops the goroutine (waiting for it to finish).
+// An interval of zero (or less) means that expired snippets are never deleted.
+func (app *application) startReaper(interval time.Duration, batch int) (stop func()) {
+	if interval <= 0 {
+		return func() {}
+	}
+
+	quit := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-quit:
+				return
+			case <-ticker.C:
+				app.purgeExpired(batch, quit)
+			}
+		}
+	}()
+
+	return func() {
+		close(quit)
+		<-done
+	}
+}
+
+// purgeExpired deletes all expired snippets (batch at a time) unless told to quit and returns how many
+func (app *application) purgeExpired(batch int, quit <-chan struct{}) int {
+	total := 0
+	for {
+		n, err := app.snippets.DeleteExpired(batch)
+		if err != nil {
+			app.errorLog.Println("purging expired snippets:", err)
+			break
+		}
+		total += n
+		if n == 0 || n < batch {
+			break // none left
+		}
+
+		select {
+		case <-quit:
+			app.infoLog.Printf("Purged %d expired snippets (stopped before all deleted)", total)
+			return total
+		default:
+		}
+	}
+
+	if total > 0 {
+		app.infoLog.Printf("Purged %d expired snippets", total)
+	}
+	return total
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/andrewwphillips/snippetbox/pkg/models"
+)
+
+// TestPurgeExpired checks that all expired snippets are deleted (in batches) and others are kept
+func TestPurgeExpired(t *testing.T) {
+	app := newTestApplication(t)
+	for i := 0; i < 5; i++ {
+		if _, _, err := app.snippets.Insert(1, "Expired", "Expired content", "", models.Public, time.Now(), "", false); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if n := app.purgeExpired(2, nil); n != 5 {
+		t.Errorf("want 5 purged; got %d", n)
+	}
+	if n := app.purgeExpired(2, nil); n != 0 {
+		t.Errorf("want 0 purged; got %d", n)
+	}
+	if s, err := app.snippets.Get(1); err != nil || s == nil {
+		t.Errorf("want snippet 1 kept; got %v, %v", s, err)
+	}
+}
+
+// signallingStore wraps a SnippetStore to signal when DeleteExpired is called
+type signallingStore struct {
+	models.SnippetStore
+	called chan struct{}
+}
+
+func (s signallingStore) DeleteExpired(limit int) (int, error) {
+	select {
+	case s.called <- struct{}{}:
+	default:
+	}
+	return s.SnippetStore.DeleteExpired(limit)
+}
+
+// TestStartReaper checks that the reaper runs in the background and can be stopped
+func TestStartReaper(t *testing.T) {
+	app := newTestApplication(t)
+	called := make(chan struct{}, 1)
+	app.snippets = signallingStore{app.snippets, called}
+
+	stop := app.startReaper(time.Millisecond, 10)
+	select {
+	case <-called:
+	case <-time.After(5 * time.Second):
+		t.Error("reaper did not run")
+	}
+	stop() // must not block
+}
@@ -35,13 +35,38 @@ func (app *application) routes(root string) http.Handler {
 
 	mux := pat.New()
 	mux.Get("/", dynamicMiddleware.ThenFunc(app.home))
-	mux.Get("/snippet/create", dynamicMiddleware.Append(app.requireAuthenticatedUser).ThenFunc(app.createSnippetForm))
-	mux.Post("/snippet/create", dynamicMiddleware.Append(app.requireAuthenticatedUser).ThenFunc(app.createSnippet))
-	mux.Get("/snippet/:id", dynamicMiddleware.ThenFunc(app.showSnippet)) // must be after "/snippet/create" in this list
+	mux.Get("/snippets", dynamicMiddleware.ThenFunc(app.home))
+	mux.Get("/search", dynamicMiddleware.ThenFunc(app.searchSnippets))
+	mux.Get("/tag/:name", dynamicMiddleware.ThenFunc(app.tagSnippets))
+	verifiedMiddleware := dynamicMiddleware.Append(app.requireAuthenticatedUser, app.requireVerifiedUser)
+	mux.Get("/snippet/create", verifiedMiddleware.ThenFunc(app.createSnippetForm))
+	mux.Post("/snippet/create", verifiedMiddleware.ThenFunc(app.createSnippet))
+	mux.Get("/snippet/:id", dynamicMiddleware.ThenFunc(app.redirectSnippet)) // must be after "/snippet/create" in this list
+	mux.Get("/s/:slug", dynamicMiddleware.ThenFunc(app.showSnippet))
+	mux.Post("/s/:slug/unlock", dynamicMiddleware.ThenFunc(app.unlockSnippet))
+	mux.Get("/s/:slug/history", dynamicMiddleware.ThenFunc(app.snippetHistory))
+	mux.Get("/s/:slug/diff", dynamicMiddleware.ThenFunc(app.snippetDiff))
+	mux.Get("/s/:slug/raw", dynamicMiddleware.ThenFunc(app.rawSnippet))
+	mux.Get("/s/:slug/download", dynamicMiddleware.ThenFunc(app.downloadSnippet))
+	ownerMiddleware := dynamicMiddleware.Append(app.requireAuthenticatedUser, app.requireSnippetOwner)
+	mux.Get("/s/:slug/edit", ownerMiddleware.ThenFunc(app.editSnippetForm))
+	mux.Post("/s/:slug/edit", ownerMiddleware.ThenFunc(app.editSnippet))
+	mux.Post("/s/:slug/delete", ownerMiddleware.ThenFunc(app.deleteSnippet))
+	mux.Get("/user/snippets", dynamicMiddleware.Append(app.requireAuthenticatedUser).ThenFunc(app.userSnippets))
 	mux.Get("/user/signup", dynamicMiddleware.ThenFunc(app.signupUserForm))
 	mux.Post("/user/signup", dynamicMiddleware.ThenFunc(app.signupUser))
 	mux.Get("/user/login", dynamicMiddleware.ThenFunc(app.loginUserForm))
 	mux.Post("/user/login", dynamicMiddleware.ThenFunc(app.loginUser))
+	mux.Get("/user/verify/:token", dynamicMiddleware.ThenFunc(app.verifyUser))
+	mux.Post("/user/verify", dynamicMiddleware.Append(app.requireAuthenticatedUser).ThenFunc(app.resendVerifyEmail))
+	mux.Get("/user/forgot", dynamicMiddleware.ThenFunc(app.forgotPasswordForm))
+	mux.Post("/user/forgot", dynamicMiddleware.ThenFunc(app.forgotPassword))
+	mux.Get("/user/reset/:token", dynamicMiddleware.ThenFunc(app.resetPasswordForm))
+	mux.Post("/user/reset/:token", dynamicMiddleware.ThenFunc(app.resetPassword))
+	mux.Get("/user/profile", dynamicMiddleware.Append(app.requireAuthenticatedUser).ThenFunc(app.userProfile))
+	mux.Post("/user/profile/name", dynamicMiddleware.Append(app.requireAuthenticatedUser).ThenFunc(app.updateName))
+	mux.Post("/user/profile/email", dynamicMiddleware.Append(app.requireAuthenticatedUser).ThenFunc(app.updateEmail))
+	mux.Post("/user/profile/password", dynamicMiddleware.Append(app.requireAuthenticatedUser).ThenFunc(app.changePassword))
 	mux.Post("/user/logout", dynamicMiddleware.Append(app.requireAuthenticatedUser).ThenFunc(app.logoutUser))
 	if root != "" {
 		// Serve files used in the UI from /static/ path using std lib file server.
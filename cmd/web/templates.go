@@ -3,9 +3,14 @@ package main
 import (
 	"html/template"
 	"log"
+	"net/url"
 	"path/filepath"
+	"regexp"
+	"strings"
 	"time"
+	"unicode/utf8"
 
+	"github.com/andrewwphillips/snippetbox/pkg/diff"
 	"github.com/andrewwphillips/snippetbox/pkg/forms"
 	"github.com/andrewwphillips/snippetbox/pkg/models"
 )
@@ -20,6 +25,16 @@ type templateData struct {
 	Form              *forms.Form
 	Snippet           *models.Snippet
 	Snippets          []*models.Snippet
+	Tags              []string           // show page: tags of Snippet
+	Expiries          []expiry           // create page: choices of when the snippet is deleted (see expiryOptions)
+	Tag               string             // tag page: the tag of the Snippets listed
+	PrevPage          string             // home/search page: URL of the page of newer snippets (if any)
+	NextPage          string             // home/search page: URL of the page of older snippets (if any)
+	Query             string             // search page: what was searched for
+	Token             string             // reset page: the one-time token from the emailed link
+	Revisions         []*models.Revision // history page: all revisions of Snippet, latest first
+	From, To          *models.Revision   // diff page: the revisions being compared
+	Hunks             []diff.Hunk        // diff page: changes to the content between From and To
 }
 
 // humanDate returns a nicely formatted string representation (UTC) of a time.Time object
@@ -27,13 +42,108 @@ func humanDate(t time.Time) string {
 	if t.IsZero() {
 		return ""
 	}
+	if !t.Before(models.Never) {
+		return "Never"
+	}
 	return t.UTC().Format("02 Jan 2006 at 15:04")
 }
 
+// diffClass returns the CSS class used to display a line of a diff
+func diffClass(k diff.Kind) string {
+	switch k {
+	case diff.Added:
+		return "added"
+	case diff.Removed:
+		return "removed"
+	}
+	return ""
+}
+
+// tagURL returns the path of the page listing the snippets with a tag
+func tagURL(tag string) string {
+	return "/tag/" + url.PathEscape(tag)
+}
+
+// wordRX matches the words of a text in the same way as models.SearchTerms
+var wordRX = regexp.MustCompile(`[\pL\pN]+`)
+
+// searchWords returns the set of words in a search query
+func searchWords(query string) map[string]bool {
+	words := make(map[string]bool)
+	for _, term := range models.SearchTerms(query) {
+		words[term] = true
+	}
+	return words
+}
+
+// highlight returns text (HTML escaped) with the words of a search query marked (<mark>)
+func highlight(query, text string) template.HTML {
+	words := searchWords(query)
+	var b strings.Builder
+	last := 0
+	for _, loc := range wordRX.FindAllStringIndex(text, -1) {
+		if words[strings.ToLower(text[loc[0]:loc[1]])] {
+			b.WriteString(template.HTMLEscapeString(text[last:loc[0]]))
+			b.WriteString("<mark>" + template.HTMLEscapeString(text[loc[0]:loc[1]]) + "</mark>")
+			last = loc[1]
+		}
+	}
+	b.WriteString(template.HTMLEscapeString(text[last:]))
+	return template.HTML(b.String())
+}
+
+// excerpt returns part of a text (up to about 120 bytes) starting just before the first
+// word of a search query that it contains, with "..." where text has been removed
+func excerpt(query, text string) string {
+	const before, length = 40, 120
+	words := searchWords(query)
+	start := 0
+	for _, loc := range wordRX.FindAllStringIndex(text, -1) {
+		if words[strings.ToLower(text[loc[0]:loc[1]])] {
+			start = loc[0]
+			break
+		}
+	}
+
+	// Get the part of the text to show without splitting a UTF-8 character
+	start -= before
+	if start < 0 {
+		start = 0
+	}
+	for start > 0 && !utf8.RuneStart(text[start]) {
+		start--
+	}
+	end := start + length
+	if end >= len(text) {
+		end = len(text)
+	}
+	for end < len(text) && !utf8.RuneStart(text[end]) {
+		end--
+	}
+
+	s := text[start:end]
+	if start > 0 {
+		s = "..." + s
+	}
+	if end < len(text) {
+		s += "..."
+	}
+	return s
+}
+
 // functions is a map  of functions (for use in HTML templates) indexed by a name (string)
 // Note that each function can only return one value (and optional error)
 var functions = template.FuncMap{
 	"humanDate": humanDate,
+	"diffClass": diffClass,
+	"highlight": highlight,
+	"excerpt":   excerpt,
+	"tagURL":    tagURL,
+
+	// Syntax highlighting (see highlight.go)
+	"highlightCode": highlightCode,
+	"languageLabel": languageLabel,
+	"languages":     func() []language { return languages },
 }
 
 const (
@@ -41,7 +151,7 @@ const (
 	// (.tmpl) files used to generate the web pages
 	pageTemplates    = "*.page.tmpl"    // Defines the pages (home, login, etc)
 	layoutTemplates  = "*.layout.tmpl"  // Base template(s) used for structure of all pages (just "base" for now)
-	partialTemplates = "*.partial.tmpl" // Parts of pages used by more than one page (just footer for now)
+	partialTemplates = "*.partial.tmpl" // Parts of pages used by more than one page (footer, page links)
 )
 
 // newTemplateCache loads and processes all the templates into a map for faster rendering
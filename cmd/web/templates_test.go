@@ -1,8 +1,12 @@
 package main
 
 import (
+	"html/template"
+	"strings"
 	"testing"
 	"time"
+
+	"github.com/andrewwphillips/snippetbox/pkg/models"
 )
 
 // TestHumanDate1 checks that the HumanDate template function returns a date in the expected format
@@ -45,6 +49,10 @@ func TestHumanDate(t *testing.T) {
 			tm:   time.Time{},
 			want: "",
 		},
+		"Never": {
+			tm:   models.Never,
+			want: "Never",
+		},
 		"CET": {
 			tm:   time.Date(2020, 12, 17, 10, 0, 0, 0, time.FixedZone("CET", 1*60*60)),
 			want: "17 Dec 2020 at 09:00",
@@ -61,3 +69,47 @@ func TestHumanDate(t *testing.T) {
 		})
 	}
 }
+
+// TestHighlight checks that the words of a search query are marked and other text is escaped
+func TestHighlight(t *testing.T) {
+	tests := map[string]struct {
+		query, text string
+		want        template.HTML
+	}{
+		"No query":   {"", "An old pond", "An old pond"},
+		"One word":   {"pond", "An old pond", "An old <mark>pond</mark>"},
+		"Case":       {"POND old", "An Old pond", "An <mark>Old</mark> <mark>pond</mark>"},
+		"Whole word": {"pond", "ponder the ponds", "ponder the ponds"},
+		"Escaped":    {"frog", "<frog> & pond", "&lt;<mark>frog</mark>&gt; &amp; pond"},
+		"Unicode":    {"café", "Le Café bleu", "Le <mark>Café</mark> bleu"},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			if got := highlight(tt.query, tt.text); got != tt.want {
+				t.Errorf("want %q; got %q", tt.want, got)
+			}
+		})
+	}
+}
+
+// TestExcerpt checks that the part of the text around the first search word is returned
+func TestExcerpt(t *testing.T) {
+	long := strings.Repeat("a ", 100) + "frog " + strings.Repeat("b ", 100)
+	tests := map[string]struct {
+		query, text string
+		want        string
+	}{
+		"Short":      {"frog", "An old pond, a frog jumps", "An old pond, a frog jumps"},
+		"Long start": {"", long, long[:120] + "..."},
+		"Middle":     {"frog", long, "..." + long[160:280] + "..."},
+		"Not found":  {"toad", long, long[:120] + "..."},
+		"UTF-8":      {"x", strings.Repeat("é", 100), strings.Repeat("é", 60) + "..."},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			if got := excerpt(tt.query, tt.text); got != tt.want {
+				t.Errorf("want %q; got %q", tt.want, got)
+			}
+		})
+	}
+}
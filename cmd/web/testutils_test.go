@@ -9,10 +9,13 @@ import (
 	"net/http/httptest"
 	"net/url"
 	"regexp"
+	"sync"
 	"testing"
 	"time"
 
-	"github.com/andrewwphillips/snippetbox/pkg/models/mock"
+	"github.com/andrewwphillips/snippetbox/pkg/mailer"
+	"github.com/andrewwphillips/snippetbox/pkg/models"
+	"github.com/andrewwphillips/snippetbox/pkg/models/memory"
 	"github.com/golangcollege/sessions"
 )
 
@@ -23,16 +26,76 @@ func newTestApplication(t *testing.T) *application {
 	session.Lifetime = 12 * time.Hour
 	session.Secure = true
 
-	// Initialize the dependencies, using the mocks for the loggers and
-	// database models.
+	// Use in-memory stores containing a (verified) user (alice@example.com) and a snippet (ID 1) created by Alice
+	users := memory.NewUserModel()
+	aliceID, err := users.Insert("Alice", "alice@example.com", "validPa$$word")
+	if err != nil {
+		t.Fatal(err)
+	}
+	token, err := users.NewToken(aliceID, models.TokenVerify, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = users.Verify(token); err != nil {
+		t.Fatal(err)
+	}
+	snippets := memory.NewSnippetModel(users)
+	if _, _, err := snippets.Insert(aliceID, "An old silent pond", "An old silent pond...", "", models.Public, time.Now().AddDate(0, 0, 365), "", false); err != nil {
+		t.Fatal(err)
+	}
+
+	// Initialize the dependencies, discarding log output
 	return &application{
 		errorLog:      log.New(io.Discard, "", 0),
 		infoLog:       log.New(io.Discard, "", 0),
 		session:       session,
-		snippets:      mock.NewSnippetModel(""),
+		snippets:      snippets,
 		templateCache: newTemplateCache("./../../ui/html/"),
-		users:         mock.NewUserModel(""),
+		users:         users,
+		mailer:        &testMailer{},
+		baseURL:       "https://snippetbox.example.com",
+	}
+}
+
+// testMailer keeps the messages sent, instead of sending them, so tests can check them
+type testMailer struct {
+	mu   sync.Mutex
+	sent []mailer.Message
+	err  error // returned by Send (instead of keeping the message) to test failures
+}
+
+func (m *testMailer) Send(msg mailer.Message) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.err != nil {
+		return m.err
+	}
+	m.sent = append(m.sent, msg)
+	return nil
+}
+
+func (m *testMailer) Close() {
+}
+
+// last returns the last message sent (and fails the test if none were)
+func (m *testMailer) last(t *testing.T) mailer.Message {
+	t.Helper()
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if len(m.sent) == 0 {
+		t.Fatal("no email sent")
 	}
+	return m.sent[len(m.sent)-1]
+}
+
+// snippetPath returns the path of the page showing a snippet (given its ID)
+func snippetPath(t *testing.T, app *application, id int) string {
+	t.Helper()
+	s, err := app.snippets.Get(id)
+	if err != nil || s == nil {
+		t.Fatalf("snippet %d: not found (%v)", id, err)
+	}
+	return snippetURL(s.Slug)
 }
 
 // testServer embeds a httptest.Server to add useful methods
@@ -63,7 +126,24 @@ func newTestServer(t *testing.T, h http.Handler) *testServer {
 // get makes a GET request to the test server & returns status, headers and body
 func (ts *testServer) get(t *testing.T, urlPath string) (int, http.Header, string) {
 	// This simulates such things as the user clicking on a link in a browser to display a page
-	response, err := ts.Client().Get(ts.URL + urlPath)
+	return ts.getAccept(t, urlPath, "")
+}
+
+// browse is like get but sends the Accept header of a browser (which wants an HTML page) rather than none (like a script)
+func (ts *testServer) browse(t *testing.T, urlPath string) (int, http.Header, string) {
+	return ts.getAccept(t, urlPath, "text/html,application/xhtml+xml,*/*;q=0.8")
+}
+
+// getAccept sends a GET request with an Accept header (unless accept is empty)
+func (ts *testServer) getAccept(t *testing.T, urlPath, accept string) (int, http.Header, string) {
+	request, err := http.NewRequest(http.MethodGet, ts.URL+urlPath, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if accept != "" {
+		request.Header.Set("Accept", accept)
+	}
+	response, err := ts.Client().Do(request)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -95,6 +175,19 @@ func (ts *testServer) postForm(t *testing.T, urlPath string, form url.Values) (i
 	return rs.StatusCode, rs.Header, body
 }
 
+// login logs in as a user by submitting the login form (the session cookie is saved in the client's jar)
+func (ts *testServer) login(t *testing.T, email, password string) {
+	_, _, body := ts.get(t, "/user/login")
+	form := url.Values{}
+	form.Add("email", email)
+	form.Add("password", password)
+	form.Add("csrf_token", extractCSRFToken(t, []byte(body)))
+
+	if code, _, _ := ts.postForm(t, "/user/login", form); code != http.StatusSeeOther {
+		t.Fatalf("login as %s: want %d; got %d", email, http.StatusSeeOther, code)
+	}
+}
+
 // regex to extract CSRF token from an HTML form
 var csrfTokenRX = regexp.MustCompile(`<input type='hidden' name='csrf_token' value='(.+)'>`)
 
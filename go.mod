@@ -3,12 +3,18 @@ module github.com/andrewwphillips/snippetbox
 go 1.19
 
 require (
+	github.com/alecthomas/chroma/v2 v2.4.0
 	github.com/bmizerany/pat v0.0.0-20210406213842-e4b6760bdd6f
 	github.com/go-sql-driver/mysql v1.7.0
 	github.com/golangcollege/sessions v1.2.0
 	github.com/justinas/alice v1.2.0
 	github.com/justinas/nosurf v1.1.1
+	github.com/lib/pq v1.10.7
+	github.com/mattn/go-sqlite3 v1.14.16
 	golang.org/x/crypto v0.0.0-20200317142112-1b76d66859c6
 )
 
-require golang.org/x/sys v0.0.0-20190412213103-97732733099d // indirect
+require (
+	github.com/dlclark/regexp2 v1.4.0 // indirect
+	golang.org/x/sys v0.0.0-20190412213103-97732733099d // indirect
+)
@@ -0,0 +1,232 @@
+// Package diff compares two texts line by line producing the hunks of a unified diff.
+package diff
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Kind says whether a line is the same in both texts, only in the new text or only in the old text
+type Kind byte
+
+const (
+	Same    Kind = ' '
+	Added   Kind = '+'
+	Removed Kind = '-'
+)
+
+// Line is one line of a hunk
+type Line struct {
+	Kind Kind
+	Text string
+}
+
+// Hunk is a group of changed lines with some unchanged (context) lines before and after
+type Hunk struct {
+	OldStart, OldLines int // first line number (1-based) and number of lines in the old text
+	NewStart, NewLines int // first line number (1-based) and number of lines in the new text
+	Lines              []Line
+}
+
+// Header returns the unified diff hunk header, eg "@@ -1,4 +1,5 @@"
+func (h Hunk) Header() string {
+	return fmt.Sprintf("@@ -%d,%d +%d,%d @@", h.OldStart, h.OldLines, h.NewStart, h.NewLines)
+}
+
+// Unified compares the lines of oldText and newText and returns the hunks of a unified diff,
+// with up to context unchanged lines around each change.  It returns nil if the texts are the same.
+func Unified(oldText, newText string, context int) []Hunk {
+	lines := compare(splitLines(oldText), splitLines(newText))
+
+	var hunks []Hunk
+	oldLine, newLine := 1, 1 // line numbers of lines[i] in the old and new texts
+	for i := 0; i < len(lines); {
+		if lines[i].Kind == Same {
+			oldLine++
+			newLine++
+			i++
+			continue
+		}
+
+		// Found a change so start a hunk including up to context lines before it
+		start := i - context
+		if start < 0 {
+			start = 0
+		}
+		h := Hunk{OldStart: oldLine - (i - start), NewStart: newLine - (i - start)}
+
+		// Extend the hunk until there are more than 2*context unchanged lines (or the end)
+		end := i
+		for same := 0; end < len(lines) && same <= 2*context; end++ {
+			if lines[end].Kind == Same {
+				same++
+			} else {
+				same = 0
+			}
+		}
+		// Trim trailing unchanged lines to leave only context lines after the last change
+		last := end - 1
+		for last > i && lines[last].Kind == Same {
+			last--
+		}
+		end = last + 1 + context
+		if end > len(lines) {
+			end = len(lines)
+		}
+
+		h.Lines = lines[start:end]
+		for _, line := range h.Lines {
+			if line.Kind != Added {
+				h.OldLines++
+			}
+			if line.Kind != Removed {
+				h.NewLines++
+			}
+		}
+		// Unified diff format uses the line before for the start of an empty range
+		if h.OldLines == 0 {
+			h.OldStart--
+		}
+		if h.NewLines == 0 {
+			h.NewStart--
+		}
+		hunks = append(hunks, h)
+
+		// Continue after the hunk, keeping track of the line numbers
+		for ; i < end; i++ {
+			if lines[i].Kind != Added {
+				oldLine++
+			}
+			if lines[i].Kind != Removed {
+				newLine++
+			}
+		}
+	}
+	return hunks
+}
+
+// splitLines splits text into lines - a final newline does not start another (empty) line
+func splitLines(text string) []string {
+	text = strings.ReplaceAll(text, "\r\n", "\n")
+	if text == "" {
+		return nil
+	}
+	return strings.Split(strings.TrimSuffix(text, "\n"), "\n")
+}
+
+// compare returns all the lines of a and b marked as Same, Removed (only in a) or Added (only in b)
+// It finds the longest common subsequence of lines so that the number of changes is minimised.  Within
+// each group of changed lines the Removed lines come before the Added lines (like diff -u).
+func compare(a, b []string) []Line {
+	lines := make([]Line, 0, len(a)+len(b))
+	lines = appendLCS(lines, a, b)
+
+	// Sort each group of changes, stably, so that Removed lines come first
+	for i := 0; i < len(lines); {
+		if lines[i].Kind == Same {
+			i++
+			continue
+		}
+		end := i
+		for end < len(lines) && lines[end].Kind != Same {
+			end++
+		}
+		sort.SliceStable(lines[i:end], func(x, y int) bool {
+			return lines[i+x].Kind == Removed && lines[i+y].Kind == Added
+		})
+		i = end
+	}
+	return lines
+}
+
+// appendLCS appends the lines of a and b (see compare) to lines.  It uses Hirschberg's algorithm which
+// takes time proportional to len(a)*len(b) but only linear space (unlike a table of all the longest
+// common subsequences) so that comparing large texts can't use up all the memory.
+func appendLCS(lines []Line, a, b []string) []Line {
+	// Lines that are the same at the start and end need no comparison (usually most of the text)
+	for len(a) > 0 && len(b) > 0 && a[0] == b[0] {
+		lines = append(lines, Line{Same, a[0]})
+		a, b = a[1:], b[1:]
+	}
+	same := 0 // number of lines that are the same at the end
+	for same < len(a) && same < len(b) && a[len(a)-1-same] == b[len(b)-1-same] {
+		same++
+	}
+	suffix := a[len(a)-same:]
+	a, b = a[:len(a)-same], b[:len(b)-same]
+
+	switch {
+	case len(a) == 0:
+		for _, text := range b {
+			lines = append(lines, Line{Added, text})
+		}
+	case len(b) == 0:
+		for _, text := range a {
+			lines = append(lines, Line{Removed, text})
+		}
+	case len(a) == 1:
+		// The single line of a is either in b or it was changed
+		k := 0
+		for k < len(b) && b[k] != a[0] {
+			k++
+		}
+		if k == len(b) {
+			lines = append(lines, Line{Removed, a[0]})
+		}
+		for j, text := range b {
+			if j == k {
+				lines = append(lines, Line{Same, text})
+			} else {
+				lines = append(lines, Line{Added, text})
+			}
+		}
+	default:
+		// Split a in half and b where the longest common subsequences of the halves add up to the most
+		mid := len(a) / 2
+		forward := lcsLengths(a[:mid], b, false)
+		backward := lcsLengths(a[mid:], b, true)
+		split := 0
+		for j := range forward {
+			if forward[j]+backward[len(b)-j] > forward[split]+backward[len(b)-split] {
+				split = j
+			}
+		}
+		lines = appendLCS(lines, a[:mid], b[:split])
+		lines = appendLCS(lines, a[mid:], b[split:])
+	}
+
+	for _, text := range suffix {
+		lines = append(lines, Line{Same, text})
+	}
+	return lines
+}
+
+// lcsLengths returns the lengths of the longest common subsequences of a and the first j lines of b
+// for j from 0 to len(b).  If reversed is true it compares the lines from the end instead, so it
+// returns the lengths for a and the last j lines of b.
+func lcsLengths(a, b []string, reversed bool) []int {
+	prev, row := make([]int, len(b)+1), make([]int, len(b)+1)
+	for i := range a {
+		x := a[i]
+		if reversed {
+			x = a[len(a)-1-i]
+		}
+		for j := 1; j <= len(b); j++ {
+			y := b[j-1]
+			if reversed {
+				y = b[len(b)-j]
+			}
+			switch {
+			case x == y:
+				row[j] = prev[j-1] + 1
+			case prev[j] >= row[j-1]:
+				row[j] = prev[j]
+			default:
+				row[j] = row[j-1]
+			}
+		}
+		prev, row = row, prev
+	}
+	return prev
+}
@@ -0,0 +1,151 @@
+package diff
+
+import (
+	"fmt"
+	"math/rand"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+// format returns the hunks as the text of a unified diff (without the file headers)
+func format(hunks []Hunk) string {
+	var b strings.Builder
+	for _, h := range hunks {
+		b.WriteString(h.Header() + "\n")
+		for _, line := range h.Lines {
+			b.WriteString(string(line.Kind) + line.Text + "\n")
+		}
+	}
+	return b.String()
+}
+
+// TestUnified compares texts checking the result against the output of diff -u
+func TestUnified(t *testing.T) {
+	tests := map[string]struct {
+		old, new string
+		want     string
+	}{
+		"Same":  {"a\nb\nc\n", "a\nb\nc\n", ""},
+		"Empty": {"", "", ""},
+		"Added to empty": {
+			"", "a\nb\n",
+			"@@ -0,0 +1,2 @@\n+a\n+b\n",
+		},
+		"All removed": {
+			"a\nb\n", "",
+			"@@ -1,2 +0,0 @@\n-a\n-b\n",
+		},
+		"Changed line": {
+			"a\nb\nc\nd\ne\nf\n", "a\nb\nc\nX\ne\nf\n",
+			"@@ -2,5 +2,5 @@\n b\n c\n-d\n+X\n e\n f\n",
+		},
+		"Inserted at start": {
+			"a\nb\nc\nd\n", "X\na\nb\nc\nd\n",
+			"@@ -1,2 +1,3 @@\n+X\n a\n b\n",
+		},
+		"Removed at end": {
+			"a\nb\nc\nd\n", "a\nb\nc\n",
+			"@@ -2,3 +2,2 @@\n b\n c\n-d\n",
+		},
+		"Close changes in one hunk": {
+			"1\n2\n3\n4\n5\n6\n7\n", "1\nX\n3\n4\n5\nY\n7\n",
+			"@@ -1,7 +1,7 @@\n 1\n-2\n+X\n 3\n 4\n 5\n-6\n+Y\n 7\n",
+		},
+		"Distant changes in two hunks": {
+			"1\n2\n3\n4\n5\n6\n7\n8\n9\n", "X\n2\n3\n4\n5\n6\n7\n8\nY\n",
+			"@@ -1,3 +1,3 @@\n-1\n+X\n 2\n 3\n@@ -7,3 +7,3 @@\n 7\n 8\n-9\n+Y\n",
+		},
+		"No final newline": {"a\nb", "a\nc", "@@ -1,2 +1,2 @@\n a\n-b\n+c\n"},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			got := format(Unified(tt.old, tt.new, 2))
+			if got != tt.want {
+				t.Errorf("want:\n%s\ngot:\n%s", tt.want, got)
+			}
+		})
+	}
+}
+
+// TestCompare checks that compare finds a longest common subsequence by comparing random texts with the
+// length found using a full table (which is only practical for small texts)
+func TestCompare(t *testing.T) {
+	rnd := rand.New(rand.NewSource(1))
+	randomLines := func() []string {
+		lines := make([]string, rnd.Intn(20))
+		for i := range lines {
+			lines[i] = string(rune('a' + rnd.Intn(4)))
+		}
+		return lines
+	}
+
+	for n := 0; n < 500; n++ {
+		a, b := randomLines(), randomLines()
+
+		// lcs[i][j] is the length of the longest common subsequence of a[i:] and b[j:]
+		lcs := make([][]int, len(a)+1)
+		for i := range lcs {
+			lcs[i] = make([]int, len(b)+1)
+		}
+		for i := len(a) - 1; i >= 0; i-- {
+			for j := len(b) - 1; j >= 0; j-- {
+				if a[i] == b[j] {
+					lcs[i][j] = lcs[i+1][j+1] + 1
+				} else if lcs[i+1][j] >= lcs[i][j+1] {
+					lcs[i][j] = lcs[i+1][j]
+				} else {
+					lcs[i][j] = lcs[i][j+1]
+				}
+			}
+		}
+
+		// The lines must be those of a and b in order, with the most possible Same lines
+		var same int
+		var gotA, gotB []string
+		for _, line := range compare(a, b) {
+			if line.Kind != Added {
+				gotA = append(gotA, line.Text)
+			}
+			if line.Kind != Removed {
+				gotB = append(gotB, line.Text)
+			}
+			if line.Kind == Same {
+				same++
+			}
+		}
+		if strings.Join(gotA, "") != strings.Join(a, "") || strings.Join(gotB, "") != strings.Join(b, "") || same != lcs[0][0] {
+			t.Fatalf("compare(%q, %q): want %d same lines; got %d (%q, %q)", a, b, lcs[0][0], same, gotA, gotB)
+		}
+	}
+}
+
+// TestUnifiedLarge checks that comparing large texts (that fit in a snippet) doesn't use a lot of memory
+func TestUnifiedLarge(t *testing.T) {
+	const n = 8000
+	var old, new strings.Builder
+	for i := 0; i < n; i++ {
+		fmt.Fprintf(&old, "%d\n", i)
+		fmt.Fprintf(&new, "%d\n", i+n/2) // the second half of old is the first half of new
+	}
+
+	var before, after runtime.MemStats
+	runtime.ReadMemStats(&before)
+	hunks := Unified(old.String(), new.String(), 3)
+	runtime.ReadMemStats(&after)
+
+	var oldLines, newLines int
+	for _, h := range hunks {
+		oldLines += h.OldLines
+		newLines += h.NewLines
+	}
+	// The old (and new) lines are the n/2 changed lines plus 3 context lines in each hunk
+	if len(hunks) != 2 || oldLines != n/2+6 || newLines != n/2+6 {
+		t.Errorf("want 2 hunks with %d old and new lines; got %d with %d old and %d new",
+			n/2+6, len(hunks), oldLines, newLines)
+	}
+	if allocated := after.TotalAlloc - before.TotalAlloc; allocated > 10<<20 {
+		t.Errorf("want less than 10 MiB allocated; got %d MiB", allocated>>20)
+	}
+}
@@ -4,13 +4,20 @@ import (
 	"fmt"
 	"net/url"
 	"regexp"
+	"strconv"
 	"strings"
+	"time"
+	"unicode"
 	"unicode/utf8"
 )
 
 // EmailRX can be used with the MatchesPattern (below) to check that a field looks like an email address
 var EmailRX = regexp.MustCompile("^[a-zA-Z0-9.!#$%&'*+\\/=?^_`{|}~-]+@[a-zA-Z0-9](?:[a-zA-Z0-9-]{0,61}[a-zA-Z0-9])?(?:\\.[a-zA-Z0-9](?:[a-zA-Z0-9-]{0,61}[a-zA-Z0-9])?)*$")
 
+// TagRX is the pattern for a single tag (see Tags) - lower case letters, digits and a few other
+// characters that are used in the names of technologies such as "c++", "c#", "k8s" and "node.js"
+var TagRX = regexp.MustCompile(`^[\p{Ll}\p{N}][\p{Ll}\p{N}+#._-]*$`)
+
 // Form is used in validation of HTML form fields to hold the field values and any validation errors
 type Form struct {
 	url.Values
@@ -81,6 +88,129 @@ func (f *Form) MatchesPattern(field string, pattern *regexp.Regexp) {
 	}
 }
 
+// Tags returns the tags in a field, which are separated by commas and/or spaces.  The tags
+// are converted to lower case and any duplicates are removed.
+func (f *Form) Tags(field string) []string {
+	var tags []string
+	seen := make(map[string]bool)
+	for _, tag := range strings.FieldsFunc(strings.ToLower(f.Get(field)), func(r rune) bool {
+		return r == ',' || unicode.IsSpace(r)
+	}) {
+		if !seen[tag] {
+			seen[tag] = true
+			tags = append(tags, tag)
+		}
+	}
+	return tags
+}
+
+// ValidTags checks that a field has no more than max tags (see Tags), that each tag matches
+// TagRX and is no longer than maxLength characters.  It allows empty fields.
+func (f *Form) ValidTags(field string, max, maxLength int) {
+	tags := f.Tags(field)
+	if len(tags) > max {
+		f.Errors.Add(field, fmt.Sprintf("Too many tags (maximum is %d)", max))
+		return
+	}
+	for _, tag := range tags {
+		if utf8.RuneCountInString(tag) > maxLength {
+			f.Errors.Add(field, fmt.Sprintf("Tag %q is too long (maximum is %d characters)", tag, maxLength))
+		} else if !TagRX.MatchString(tag) {
+			f.Errors.Add(field, fmt.Sprintf("Tag %q is invalid (use letters, digits and + # . _ -)", tag))
+		}
+	}
+}
+
+// daysRX splits a duration with days (see ParseDuration) into the days and the rest
+var daysRX = regexp.MustCompile(`^([0-9]+)d(.*)$`)
+
+// ParseDuration is like time.ParseDuration but also allows a number of days at the start, eg
+// "7d" or "1d12h", and does not allow negative durations
+func ParseDuration(s string) (time.Duration, error) {
+	var days time.Duration
+	rest := s
+	if m := daysRX.FindStringSubmatch(s); m != nil {
+		n, err := strconv.Atoi(m[1])
+		if err != nil || n > maxDays {
+			return 0, fmt.Errorf("forms: invalid duration %q", s)
+		}
+		days = time.Duration(n) * 24 * time.Hour
+		if rest = m[2]; rest == "" {
+			return days, nil
+		}
+	}
+	d, err := time.ParseDuration(rest)
+	if err != nil {
+		return 0, err
+	}
+	if d < 0 || days+d < days {
+		return 0, fmt.Errorf("forms: invalid duration %q", s)
+	}
+	return days + d, nil
+}
+
+// maxDays is the most days allowed by ParseDuration (a time.Duration can only hold about 290 years)
+const maxDays = 100000
+
+// describeDuration returns a duration in words (for error messages), eg "30 days" or "10 minutes"
+func describeDuration(d time.Duration) string {
+	plural := func(n time.Duration, unit string) string {
+		if n == 1 {
+			return "1 " + unit
+		}
+		return fmt.Sprintf("%d %ss", n, unit)
+	}
+	switch {
+	case d >= 24*time.Hour && d%(24*time.Hour) == 0:
+		return plural(d/(24*time.Hour), "day")
+	case d >= time.Hour && d%time.Hour == 0:
+		return plural(d/time.Hour, "hour")
+	case d >= time.Minute && d%time.Minute == 0:
+		return plural(d/time.Minute, "minute")
+	}
+	return d.String()
+}
+
+// ValidDuration checks that a field is a duration (see ParseDuration) of at least min and no more
+// than max, where a max of zero means there is no maximum.  It allows empty fields.
+func (f *Form) ValidDuration(field string, min, max time.Duration) {
+	value := f.Get(field)
+	if value == "" {
+		return
+	}
+	d, err := ParseDuration(value)
+	switch {
+	case err != nil:
+		f.Errors.Add(field, "This field is invalid")
+	case d < min:
+		f.Errors.Add(field, fmt.Sprintf("This is too short (minimum is %s)", describeDuration(min)))
+	case max != 0 && d > max:
+		f.Errors.Add(field, fmt.Sprintf("This is too long (maximum is %s)", describeDuration(max)))
+	}
+}
+
+// ValidFutureTime checks that a field is a time (in the layout, eg "2006-01-02T15:04", taken as UTC)
+// that is after now, at least min from now and no more than max from now, where a max of zero means
+// there is no maximum.  It allows empty fields.
+func (f *Form) ValidFutureTime(field, layout string, min, max time.Duration) {
+	value := f.Get(field)
+	if value == "" {
+		return
+	}
+	t, err := time.ParseInLocation(layout, value, time.UTC)
+	now := time.Now()
+	switch {
+	case err != nil:
+		f.Errors.Add(field, "This field is invalid")
+	case !t.After(now):
+		f.Errors.Add(field, "This time has already passed")
+	case t.Before(now.Add(min)):
+		f.Errors.Add(field, fmt.Sprintf("This is too soon (minimum is %s ahead)", describeDuration(min)))
+	case max != 0 && t.After(now.Add(max)):
+		f.Errors.Add(field, fmt.Sprintf("This is too far ahead (maximum is %s)", describeDuration(max)))
+	}
+}
+
 // Valid returns true if there were no errors in validating the form
 func (f *Form) Valid() bool {
 	return len(f.Errors) == 0
@@ -0,0 +1,102 @@
+package forms
+
+import (
+	"net/url"
+	"testing"
+	"time"
+)
+
+// TestParseDuration checks that durations can be given in days as well as the units of time.ParseDuration
+func TestParseDuration(t *testing.T) {
+	tests := map[string]struct {
+		s       string
+		want    time.Duration
+		wantErr bool
+	}{
+		"Minutes":      {s: "10m", want: 10 * time.Minute},
+		"Hours":        {s: "1h30m", want: 90 * time.Minute},
+		"Days":         {s: "7d", want: 7 * 24 * time.Hour},
+		"Days and":     {s: "1d12h", want: 36 * time.Hour},
+		"Zero":         {s: "0s", want: 0},
+		"Empty":        {s: "", wantErr: true},
+		"Negative":     {s: "-1h", wantErr: true},
+		"Negative and": {s: "1d-1h", wantErr: true},
+		"No unit":      {s: "7", wantErr: true},
+		"Days twice":   {s: "1d1d", wantErr: true},
+		"Too many":     {s: "1000000d", wantErr: true},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			got, err := ParseDuration(tt.s)
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("want error; got %v", got)
+				}
+				return
+			}
+			if err != nil || got != tt.want {
+				t.Errorf("want %v; got %v, %v", tt.want, got, err)
+			}
+		})
+	}
+}
+
+// TestValidDuration checks durations are checked against the minimum and (optional) maximum
+func TestValidDuration(t *testing.T) {
+	tests := map[string]struct {
+		value    string
+		max      time.Duration
+		wantErrs string
+	}{
+		"Valid":      {value: "1h"},
+		"Empty":      {value: ""},
+		"Invalid":    {value: "soon", wantErrs: "This field is invalid"},
+		"Too short":  {value: "30s", wantErrs: "This is too short (minimum is 1 minute)"},
+		"No maximum": {value: "365d"},
+		"Maximum":    {value: "30d", max: 30 * 24 * time.Hour},
+		"Too long":   {value: "31d", max: 30 * 24 * time.Hour, wantErrs: "This is too long (maximum is 30 days)"},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			form := New(url.Values{"expires": {tt.value}})
+			form.ValidDuration("expires", time.Minute, tt.max)
+			if got := form.Errors.Get("expires"); got != tt.wantErrs {
+				t.Errorf("want %q; got %q", tt.wantErrs, got)
+			}
+		})
+	}
+}
+
+// TestValidFutureTime checks times must be in the future, at least the minimum ahead and no further ahead
+// than the (optional) maximum
+func TestValidFutureTime(t *testing.T) {
+	const layout = "2006-01-02T15:04"
+	now := time.Now().UTC()
+	tests := map[string]struct {
+		value    string
+		max      time.Duration
+		wantErrs string
+	}{
+		"Valid":       {value: now.Add(time.Hour).Format(layout)},
+		"Empty":       {value: ""},
+		"Invalid":     {value: "tomorrow", wantErrs: "This field is invalid"},
+		"Passed":      {value: now.Add(-time.Hour).Format(layout), wantErrs: "This time has already passed"},
+		"Too soon":    {value: now.Add(2 * time.Minute).Format(layout), wantErrs: "This is too soon (minimum is 10 minutes ahead)"},
+		"Far ahead":   {value: now.AddDate(100, 0, 0).Format(layout)},
+		"Maximum":     {value: now.Add(time.Hour).Format(layout), max: 2 * time.Hour},
+		"Too far":     {value: now.Add(3 * time.Hour).Format(layout), max: 2 * time.Hour, wantErrs: "This is too far ahead (maximum is 2 hours)"},
+		"Other zones": {value: now.Add(time.Hour).Format(time.RFC3339), wantErrs: "This field is invalid"},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			form := New(url.Values{"expires_at": {tt.value}})
+			form.ValidFutureTime("expires_at", layout, 10*time.Minute, tt.max)
+			if got := form.Errors.Get("expires_at"); got != tt.wantErrs {
+				t.Errorf("want %q; got %q", tt.wantErrs, got)
+			}
+		})
+	}
+}
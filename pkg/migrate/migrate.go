@@ -0,0 +1,261 @@
+// Package migrate creates and upgrades database schemas using numbered migrations.
+//
+// Each migration is a pair of SQL files named like "0002_add_author.up.sql" and
+// "0002_add_author.down.sql" where the number is the version (applied in ascending
+// order) and the down file reverses the changes of the up file.  The versions that
+// have been applied are recorded in the schema_migrations table.
+package migrate
+
+import (
+	"database/sql"
+	"fmt"
+	"io/fs"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Migration is one numbered change to the database schema
+type Migration struct {
+	Version  int
+	Name     string
+	Up, Down string // SQL statements (separated by semicolons at the end of a line)
+}
+
+// Status is a migration and when it was applied (zero if not yet applied)
+type Status struct {
+	Migration
+	Applied time.Time
+}
+
+// fileRX matches the names of migration files, capturing the version, name and direction
+var fileRX = regexp.MustCompile(`^(\d+)_(\w+)\.(up|down)\.sql$`)
+
+// Load reads the migrations from the *.sql files in the root directory of fsys
+// They are returned in version order.  It is an error for a migration to have no down file.
+func Load(fsys fs.FS) ([]Migration, error) {
+	files, err := fs.Glob(fsys, "*.sql")
+	if err != nil {
+		return nil, err
+	}
+
+	byVersion := make(map[int]*Migration)
+	for _, file := range files {
+		matches := fileRX.FindStringSubmatch(path.Base(file))
+		if matches == nil {
+			return nil, fmt.Errorf("migrate: invalid migration file name %q", file)
+		}
+		version, _ := strconv.Atoi(matches[1])
+		m, ok := byVersion[version]
+		if !ok {
+			m = &Migration{Version: version, Name: matches[2]}
+			byVersion[version] = m
+		} else if m.Name != matches[2] {
+			return nil, fmt.Errorf("migrate: version %d used for %q and %q", version, m.Name, matches[2])
+		}
+
+		text, err := fs.ReadFile(fsys, file)
+		if err != nil {
+			return nil, err
+		}
+		if matches[3] == "up" {
+			m.Up = string(text)
+		} else {
+			m.Down = string(text)
+		}
+	}
+
+	migrations := make([]Migration, 0, len(byVersion))
+	for _, m := range byVersion {
+		if m.Up == "" || m.Down == "" {
+			return nil, fmt.Errorf("migrate: migration %04d_%s needs both up and down files", m.Version, m.Name)
+		}
+		migrations = append(migrations, *m)
+	}
+	sort.Slice(migrations, func(i, j int) bool { return migrations[i].Version < migrations[j].Version })
+	return migrations, nil
+}
+
+// Migrator applies and reverts migrations on a database
+type Migrator struct {
+	DB         *sql.DB
+	Migrations []Migration // in version order (see Load)
+	Numbered   bool        // use $1, $2 (PostgreSQL) rather than ? query placeholders
+}
+
+func (m *Migrator) Close() {
+	m.DB.Close()
+}
+
+// placeholder returns the query parameter placeholder for the nth (1-based) parameter
+func (m *Migrator) placeholder(n int) string {
+	if m.Numbered {
+		return "$" + strconv.Itoa(n)
+	}
+	return "?"
+}
+
+// init creates the table that records the applied migrations (if not already there)
+func (m *Migrator) init() error {
+	_, err := m.DB.Exec("CREATE TABLE IF NOT EXISTS schema_migrations " +
+		"(version INTEGER NOT NULL PRIMARY KEY, applied TIMESTAMP NOT NULL)")
+	return err
+}
+
+// applied returns when each of the applied migrations was applied indexed by version
+func (m *Migrator) applied() (map[int]time.Time, error) {
+	if err := m.init(); err != nil {
+		return nil, err
+	}
+	rows, err := m.DB.Query("SELECT version, applied FROM schema_migrations")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	applied := make(map[int]time.Time)
+	for rows.Next() {
+		var version int
+		var at time.Time
+		if err = rows.Scan(&version, &at); err != nil {
+			return nil, err
+		}
+		applied[version] = at
+	}
+	return applied, rows.Err()
+}
+
+// Status returns all the migrations and when (if ever) they were applied
+func (m *Migrator) Status() ([]Status, error) {
+	applied, err := m.applied()
+	if err != nil {
+		return nil, err
+	}
+	status := make([]Status, len(m.Migrations))
+	for i, migration := range m.Migrations {
+		status[i] = Status{migration, applied[migration.Version]}
+	}
+	return status, nil
+}
+
+// Up applies all the migrations that have not yet been applied and returns them
+// If one fails it stops, returning the migrations that were applied and the error.
+func (m *Migrator) Up() ([]Migration, error) {
+	applied, err := m.applied()
+	if err != nil {
+		return nil, err
+	}
+
+	var done []Migration
+	for _, migration := range m.Migrations {
+		if _, ok := applied[migration.Version]; ok {
+			continue
+		}
+		record := fmt.Sprintf("INSERT INTO schema_migrations (version, applied) VALUES (%s, %s)",
+			m.placeholder(1), m.placeholder(2))
+		if err = m.run(migration.Up, record, migration.Version, time.Now().UTC()); err != nil {
+			return done, fmt.Errorf("migrate: %04d_%s up: %w", migration.Version, migration.Name, err)
+		}
+		done = append(done, migration)
+	}
+	return done, nil
+}
+
+// Down reverts the most recently applied migration and returns it, or returns nil if none are applied
+func (m *Migrator) Down() (*Migration, error) {
+	applied, err := m.applied()
+	if err != nil {
+		return nil, err
+	}
+
+	for i := len(m.Migrations) - 1; i >= 0; i-- {
+		migration := m.Migrations[i]
+		if _, ok := applied[migration.Version]; !ok {
+			continue
+		}
+		record := "DELETE FROM schema_migrations WHERE version = " + m.placeholder(1)
+		if err = m.run(migration.Down, record, migration.Version); err != nil {
+			return nil, fmt.Errorf("migrate: %04d_%s down: %w", migration.Version, migration.Name, err)
+		}
+		return &migration, nil
+	}
+	return nil, nil
+}
+
+// run executes the statements of a migration followed by the query (record) that updates
+// schema_migrations, in a transaction.  (Note that MySQL commits after each statement that
+// changes the schema so a failed migration may be partially applied.)
+func (m *Migrator) run(script, record string, args ...interface{}) error {
+	tx, err := m.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback() // no effect after Commit
+
+	for _, stmt := range statements(script) {
+		if _, err = tx.Exec(stmt); err != nil {
+			return err
+		}
+	}
+	if _, err = tx.Exec(record, args...); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// statements splits a script into separate SQL statements (not all drivers can execute several at once)
+// A statement ends with a semicolon at the end of a line.  Lines that are only a comment are removed.
+func statements(script string) []string {
+	var stmts []string
+	var current strings.Builder
+	for _, line := range strings.Split(script, "\n") {
+		trimmed := strings.TrimSpace(line)
+		if trimmed == "" || strings.HasPrefix(trimmed, "--") {
+			continue
+		}
+		current.WriteString(line)
+		current.WriteString("\n")
+		if strings.HasSuffix(trimmed, ";") {
+			stmts = append(stmts, strings.TrimSpace(current.String()))
+			current.Reset()
+		}
+	}
+	if s := strings.TrimSpace(current.String()); s != "" {
+		stmts = append(stmts, s)
+	}
+	return stmts
+}
+
+// OpenFunc returns a Migrator for the database given by dsn
+type OpenFunc func(dsn string) (*Migrator, error)
+
+var (
+	sourcesMu sync.RWMutex
+	sources   = make(map[string]OpenFunc)
+)
+
+// Register makes the migrations of a storage backend available using the same
+// name as the backend (see models.Register).  It panics if called twice for a name.
+func Register(name string, open OpenFunc) {
+	sourcesMu.Lock()
+	defer sourcesMu.Unlock()
+	if _, dup := sources[name]; dup {
+		panic("migrate: Register called twice for " + name)
+	}
+	sources[name] = open
+}
+
+// Open returns a Migrator for the named storage backend
+func Open(name, dsn string) (*Migrator, error) {
+	sourcesMu.RLock()
+	open, ok := sources[name]
+	sourcesMu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("migrate: store %q does not use migrations", name)
+	}
+	return open(dsn)
+}
@@ -0,0 +1,113 @@
+package migrate
+
+import (
+	"database/sql"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"testing/fstest"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+// testFiles are the migrations used in testing (note that they are not in version order)
+var testFiles = fstest.MapFS{
+	"0002_add_tags.up.sql":        {Data: []byte("-- comments are ignored\nCREATE TABLE tags (name TEXT);\nCREATE TABLE more (x INTEGER);\n")},
+	"0002_add_tags.down.sql":      {Data: []byte("DROP TABLE more;\nDROP TABLE tags;\n")},
+	"0001_create_tables.up.sql":   {Data: []byte("CREATE TABLE snippets\n(\n    id INTEGER\n);\n")},
+	"0001_create_tables.down.sql": {Data: []byte("DROP TABLE snippets;")},
+}
+
+// TestLoad checks that migration files are loaded in version order and that invalid files are rejected
+func TestLoad(t *testing.T) {
+	migrations, err := Load(testFiles)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, m := range migrations {
+		got = append(got, m.Name)
+	}
+	if want := []string{"create_tables", "add_tags"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("want %v; got %v", want, got)
+	}
+
+	tests := map[string]fstest.MapFS{
+		"Bad name":     {"create_tables.up.sql": {}},
+		"Missing down": {"0001_create_tables.up.sql": {Data: []byte("CREATE TABLE x (y INTEGER);")}},
+		"Clashing version": {
+			"0001_a.up.sql": {Data: []byte("x")}, "0001_a.down.sql": {Data: []byte("x")},
+			"0001_b.up.sql": {Data: []byte("x")}, "0001_b.down.sql": {Data: []byte("x")},
+		},
+	}
+	for name, files := range tests {
+		t.Run(name, func(t *testing.T) {
+			if _, err := Load(files); err == nil {
+				t.Error("expected an error")
+			}
+		})
+	}
+}
+
+// TestMigrator checks applying and reverting migrations (using an SQLite database)
+func TestMigrator(t *testing.T) {
+	db, err := sql.Open("sqlite3", filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	migrations, err := Load(testFiles)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := &Migrator{DB: db, Migrations: migrations}
+
+	// Initially nothing is applied
+	checkApplied(t, m, false, false)
+
+	applied, err := m.Up()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(applied) != 2 {
+		t.Errorf("want 2 migrations applied; got %d", len(applied))
+	}
+	checkApplied(t, m, true, true)
+	if _, err = db.Exec("INSERT INTO more (x) VALUES (42)"); err != nil {
+		t.Errorf("table from migration 2 not created: %v", err)
+	}
+
+	// Up again does nothing
+	if applied, err = m.Up(); err != nil || len(applied) != 0 {
+		t.Errorf("want nothing applied; got %d, %v", len(applied), err)
+	}
+
+	// Down reverts one migration at a time (latest first)
+	for _, wantVersion := range []int{2, 1} {
+		reverted, err := m.Down()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if reverted == nil || reverted.Version != wantVersion {
+			t.Fatalf("want version %d reverted; got %v", wantVersion, reverted)
+		}
+		checkApplied(t, m, wantVersion > 1, false)
+	}
+	if reverted, err := m.Down(); err != nil || reverted != nil {
+		t.Errorf("want nothing reverted; got %v, %v", reverted, err)
+	}
+}
+
+// checkApplied checks the Status of the 2 test migrations
+func checkApplied(t *testing.T, m *Migrator, want ...bool) {
+	t.Helper()
+	status, err := m.Status()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, s := range status {
+		if got := !s.Applied.IsZero(); got != want[i] {
+			t.Errorf("migration %d: want applied %v; got %v", s.Version, want[i], got)
+		}
+	}
+}
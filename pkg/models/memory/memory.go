@@ -0,0 +1,24 @@
+// Package memory implements the snippetbox storage backend by keeping all data in memory.
+// It is safe for concurrent use and is useful for testing and demos (but data is lost on exit).
+package memory
+
+import (
+	"github.com/andrewwphillips/snippetbox/pkg/models"
+)
+
+// init registers this package as the "memory" storage backend
+func init() {
+	models.Register("memory", open)
+}
+
+// Make sure the models implement all the methods required by the app
+var (
+	_ models.SnippetStore = (*SnippetModel)(nil)
+	_ models.UserStore    = (*UserModel)(nil)
+)
+
+// open is the models.Backend function that creates the snippet and user stores (dsn is not used)
+func open(dsn string) (models.SnippetStore, models.UserStore, error) {
+	users := NewUserModel()
+	return NewSnippetModel(users), users, nil
+}
@@ -0,0 +1,365 @@
+package memory
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/andrewwphillips/snippetbox/pkg/models"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// SnippetModel keeps snippets in memory
+type SnippetModel struct {
+	mu        sync.RWMutex
+	snippets  map[int]*models.Snippet
+	revisions map[int][]*models.Revision // revisions of each snippet (by ID), oldest first
+	tags      map[int][]string           // tags of each snippet (by ID), sorted
+	passwords map[int][]byte             // hashed passwords of protected snippets (by ID)
+	lastID    int                        // IDs are allocated sequentially (like AUTO_INCREMENT)
+	users     *UserModel                 // used to look up the name of a snippet's author (may be nil)
+}
+
+// NewSnippetModel creates an empty in-memory snippet store.  The users store is used
+// to find the names of authors (like a database join) but may be nil.
+func NewSnippetModel(users *UserModel) *SnippetModel {
+	return &SnippetModel{
+		snippets:  make(map[int]*models.Snippet),
+		revisions: make(map[int][]*models.Revision),
+		tags:      make(map[int][]string),
+		passwords: make(map[int][]byte),
+		users:     users,
+	}
+}
+
+// withAuthor returns a copy of a snippet (so the caller can't modify the stored one) with the author's name
+func (m *SnippetModel) withAuthor(s *models.Snippet) *models.Snippet {
+	copied := *s
+	if m.users != nil {
+		if user, _ := m.users.Get(s.UserID); user != nil {
+			copied.Author = user.Name
+		}
+	}
+	return &copied
+}
+
+// newer returns true if snippet a comes before b when ordered newest first - using the ID to
+// decide if created at the same time
+func newer(a, b *models.Snippet) bool {
+	if !a.Created.Equal(b.Created) {
+		return a.Created.After(b.Created)
+	}
+	return a.ID > b.ID
+}
+
+// sortNewest sorts snippets newest first
+func sortNewest(snippets []*models.Snippet) {
+	sort.Slice(snippets, func(i, j int) bool {
+		return newer(snippets[i], snippets[j])
+	})
+}
+
+func (m *SnippetModel) Close() {
+}
+
+// Insert adds a new snippet created by a user (ID) that is kept until the expires time (models.Never for ever).
+// If password is not empty a hash of it is stored (same as the database backends) and it is needed to
+// view the snippet (see Unlock).  It returns the ID and (new random) slug of the snippet.
+func (m *SnippetModel) Insert(userID int, title, content, language, visibility string, expires time.Time, password string, burn bool) (int, string, error) {
+	slug, err := models.NewSlug()
+	if err != nil {
+		return 0, "", err
+	}
+	var hashedPassword []byte
+	if password != "" {
+		bCryptCost := 12
+		if hashedPassword, err = bcrypt.GenerateFromPassword([]byte(password), bCryptCost); err != nil {
+			return 0, "", err
+		}
+	}
+	now := time.Now().UTC()
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.lastID++
+	m.snippets[m.lastID] = &models.Snippet{
+		ID:               m.lastID,
+		Slug:             slug,
+		UserID:           userID,
+		Title:            title,
+		Content:          content,
+		Language:         language,
+		Visibility:       visibility,
+		BurnAfterReading: burn,
+		Protected:        hashedPassword != nil,
+		Created:          now,
+		Expires:          expires.UTC(),
+	}
+	if hashedPassword != nil {
+		m.passwords[m.lastID] = hashedPassword
+	}
+	m.addRevision(m.snippets[m.lastID], now)
+	return m.lastID, slug, nil
+}
+
+// addRevision saves the current title and content of a snippet as its next revision (the caller must hold the lock)
+func (m *SnippetModel) addRevision(s *models.Snippet, created time.Time) {
+	m.revisions[s.ID] = append(m.revisions[s.ID], &models.Revision{
+		SnippetID: s.ID,
+		Number:    len(m.revisions[s.ID]) + 1,
+		Title:     s.Title,
+		Content:   s.Content,
+		Created:   created,
+	})
+}
+
+// Get returns a copy of a snippet as long as it has not expired (whatever its visibility), or nil
+// (and no error) if not found
+func (m *SnippetModel) Get(id int) (*models.Snippet, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	s, ok := m.snippets[id]
+	if !ok || !s.Expires.After(time.Now()) {
+		return nil, nil
+	}
+	return m.withAuthor(s), nil
+}
+
+// GetBySlug is like Get but finds the snippet using its slug
+func (m *SnippetModel) GetBySlug(slug string) (*models.Snippet, error) {
+	now := time.Now()
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	for _, s := range m.snippets {
+		if s.Slug == slug && s.Expires.After(now) {
+			return m.withAuthor(s), nil
+		}
+	}
+	return nil, nil
+}
+
+// Unlock checks the password of a protected snippet.  It returns models.ErrInvalidCredentials if the
+// snippet is not found or the password is wrong, and nil if it is right or the snippet has no password.
+func (m *SnippetModel) Unlock(id int, password string) error {
+	m.mu.RLock()
+	s, ok := m.snippets[id]
+	found := ok && s.Expires.After(time.Now())
+	hashedPassword := m.passwords[id]
+	m.mu.RUnlock()
+	if !found {
+		return models.ErrInvalidCredentials
+	}
+	if hashedPassword == nil {
+		return nil
+	}
+
+	// The stored hash is never modified so it is safe to use after releasing the lock
+	err := bcrypt.CompareHashAndPassword(hashedPassword, []byte(password))
+	if err == bcrypt.ErrMismatchedHashAndPassword {
+		return models.ErrInvalidCredentials
+	}
+	return err
+}
+
+// Burn gets a snippet and deletes it (as one operation) so that only one caller gets it.  It returns
+// nil (and no error) if the snippet is not found, eg if it has already been burned.
+func (m *SnippetModel) Burn(id int) (*models.Snippet, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	s, ok := m.snippets[id]
+	if !ok || !s.Expires.After(time.Now()) {
+		return nil, nil
+	}
+	s = m.withAuthor(s)
+	delete(m.snippets, id)
+	delete(m.revisions, id)
+	delete(m.tags, id)
+	delete(m.passwords, id)
+	return s, nil
+}
+
+// Page returns up to limit (unexpired, public) snippets, newest first, that are older than the cursor,
+// or if cursor.Newer is set the (up to limit) snippets just newer than the cursor.  The zero
+// Cursor gets the latest snippets.
+func (m *SnippetModel) Page(cursor models.Cursor, limit int) ([]*models.Snippet, error) {
+	return m.page(nil, cursor, limit), nil
+}
+
+// Search is like Page but only gets snippets whose title or content contain all the words of
+// the query (see models.SearchTerms)
+func (m *SnippetModel) Search(query string, cursor models.Cursor, limit int) ([]*models.Snippet, error) {
+	terms := models.SearchTerms(query)
+	if len(terms) == 0 {
+		return []*models.Snippet{}, nil
+	}
+
+	return m.page(func(s *models.Snippet) bool {
+		words := make(map[string]bool)
+		for _, word := range models.SearchTerms(s.Title + " " + s.Content) {
+			words[word] = true
+		}
+		for _, term := range terms {
+			if !words[term] {
+				return false
+			}
+		}
+		return true
+	}, cursor, limit), nil
+}
+
+// page gets a page of listed snippets (see Snippet.Listed) for which match returns true (or all if match is nil).
+// Note that match is called with the (read) lock held.
+func (m *SnippetModel) page(match func(*models.Snippet) bool, cursor models.Cursor, limit int) []*models.Snippet {
+	now := time.Now()
+	at := &models.Snippet{ID: cursor.ID, Created: cursor.Created} // the position of the cursor
+
+	m.mu.RLock()
+	snippets := make([]*models.Snippet, 0, len(m.snippets))
+	for _, s := range m.snippets {
+		if !s.Expires.After(now) || !s.Listed() || (match != nil && !match(s)) {
+			continue
+		}
+		if cursor.ID == 0 || (cursor.Newer && newer(s, at)) || (!cursor.Newer && newer(at, s)) {
+			snippets = append(snippets, m.withAuthor(s))
+		}
+	}
+	m.mu.RUnlock()
+
+	sortNewest(snippets)
+	if len(snippets) > limit {
+		if cursor.Newer && cursor.ID != 0 {
+			snippets = snippets[len(snippets)-limit:] // those closest to the cursor
+		} else {
+			snippets = snippets[:limit]
+		}
+	}
+	return snippets
+}
+
+// ByUser returns all the (unexpired) snippets created by a user, whatever their visibility, newest first
+func (m *SnippetModel) ByUser(userID int) ([]*models.Snippet, error) {
+	now := time.Now()
+
+	m.mu.RLock()
+	snippets := []*models.Snippet{}
+	for _, s := range m.snippets {
+		if s.UserID == userID && s.Expires.After(now) {
+			snippets = append(snippets, m.withAuthor(s))
+		}
+	}
+	m.mu.RUnlock()
+
+	sortNewest(snippets)
+	return snippets, nil
+}
+
+// Update changes the title, content, language and visibility of a snippet (there is no error if the snippet does not exist)
+// The new version is saved as the next revision of the snippet.
+func (m *SnippetModel) Update(id int, title, content, language, visibility string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if s, ok := m.snippets[id]; ok {
+		s.Title = title
+		s.Content = content
+		s.Language = language
+		s.Visibility = visibility
+		m.addRevision(s, time.Now().UTC())
+	}
+	return nil
+}
+
+// Delete removes a snippet (there is no error if the snippet does not exist)
+func (m *SnippetModel) Delete(id int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.snippets, id)
+	delete(m.revisions, id)
+	delete(m.tags, id)
+	delete(m.passwords, id)
+	return nil
+}
+
+// SetTags replaces the tags of a snippet (there is no error if the snippet does not exist)
+func (m *SnippetModel) SetTags(snippetID int, tags []string) error {
+	sorted := append([]string(nil), tags...)
+	sort.Strings(sorted)
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.snippets[snippetID]; !ok {
+		return nil
+	}
+	if len(sorted) == 0 {
+		delete(m.tags, snippetID)
+	} else {
+		m.tags[snippetID] = sorted
+	}
+	return nil
+}
+
+// Tags returns (a copy of) the tags of a snippet in alphabetical order
+func (m *SnippetModel) Tags(snippetID int) ([]string, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return append([]string{}, m.tags[snippetID]...), nil
+}
+
+// ByTag is like Page but only gets snippets with the tag
+func (m *SnippetModel) ByTag(tag string, cursor models.Cursor, limit int) ([]*models.Snippet, error) {
+	return m.page(func(s *models.Snippet) bool {
+		for _, t := range m.tags[s.ID] {
+			if t == tag {
+				return true
+			}
+		}
+		return false
+	}, cursor, limit), nil
+}
+
+// Revisions returns copies of all the revisions of a snippet, latest first
+func (m *SnippetModel) Revisions(snippetID int) ([]*models.Revision, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	stored := m.revisions[snippetID]
+	revisions := make([]*models.Revision, 0, len(stored))
+	for i := len(stored) - 1; i >= 0; i-- {
+		copied := *stored[i]
+		revisions = append(revisions, &copied)
+	}
+	return revisions, nil
+}
+
+// Revision returns a copy of one revision of a snippet or nil (and no error) if not found
+func (m *SnippetModel) Revision(snippetID, number int) (*models.Revision, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	stored := m.revisions[snippetID]
+	if number < 1 || number > len(stored) {
+		return nil, nil
+	}
+	copied := *stored[number-1]
+	return &copied, nil
+}
+
+// DeleteExpired deletes up to limit snippets that have expired and returns how many were deleted
+func (m *SnippetModel) DeleteExpired(limit int) (int, error) {
+	now := time.Now()
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	n := 0
+	for id, s := range m.snippets {
+		if n >= limit {
+			break
+		}
+		if !s.Expires.After(now) {
+			delete(m.snippets, id)
+			delete(m.revisions, id)
+			delete(m.tags, id)
+			delete(m.passwords, id)
+			n++
+		}
+	}
+	return n, nil
+}
@@ -0,0 +1,42 @@
+package memory
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/andrewwphillips/snippetbox/pkg/models"
+)
+
+// TestSnippetModelConcurrent checks that snippets can be added and read from many goroutines
+// at once (run with -race) and that every insert gets its own ID
+func TestSnippetModelConcurrent(t *testing.T) {
+	const count = 50
+	m := NewSnippetModel(nil)
+
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	ids := make(map[int]bool)
+	for i := 0; i < count; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			id, _, err := m.Insert(1, "title", "content", "", models.Public, time.Now().AddDate(0, 0, 1), "", false)
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			if _, err := m.Page(models.Cursor{}, 10); err != nil {
+				t.Error(err)
+			}
+			mu.Lock()
+			ids[id] = true
+			mu.Unlock()
+		}()
+	}
+	wg.Wait()
+
+	if len(ids) != count {
+		t.Errorf("want %d unique IDs; got %d", count, len(ids))
+	}
+}
@@ -0,0 +1,16 @@
+package memory
+
+import (
+	"testing"
+
+	"github.com/andrewwphillips/snippetbox/pkg/models"
+	"github.com/andrewwphillips/snippetbox/pkg/models/storetest"
+)
+
+// TestStore runs the storage backend conformance tests
+func TestStore(t *testing.T) {
+	storetest.Run(t, func(t *testing.T) (models.SnippetStore, models.UserStore) {
+		users := NewUserModel()
+		return NewSnippetModel(users), users
+	})
+}
@@ -0,0 +1,275 @@
+package memory
+
+import (
+	"sync"
+	"time"
+
+	"github.com/andrewwphillips/snippetbox/pkg/models"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// UserModel keeps users (logins) in memory
+type UserModel struct {
+	mu     sync.RWMutex
+	users  map[int]*models.User // stored users are never modified (they are replaced) so can be used after unlocking
+	tokens map[string]*token    // one-time tokens (see NewToken) by the hash of the token
+	lastID int
+}
+
+// token is a one-time token emailed to a user (see NewToken)
+type token struct {
+	userID  int
+	purpose string
+	expires time.Time
+}
+
+// NewUserModel creates an empty in-memory user store
+func NewUserModel() *UserModel {
+	return &UserModel{
+		users:  make(map[int]*models.User),
+		tokens: make(map[string]*token),
+	}
+}
+
+func (m *UserModel) Close() {
+}
+
+// Insert adds a new user, storing a hash of the password (same as the database backends)
+// It returns models.ErrDuplicateEmail if the email address is already in use
+func (m *UserModel) Insert(name, email, password string) (int, error) {
+	bCryptCost := 12
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), bCryptCost)
+	if err != nil {
+		return 0, err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, user := range m.users {
+		if user.Email == email {
+			return 0, models.ErrDuplicateEmail
+		}
+	}
+	m.lastID++
+	m.users[m.lastID] = &models.User{
+		ID:             m.lastID,
+		Name:           name,
+		Email:          email,
+		HashedPassword: hashedPassword,
+		Created:        time.Now().UTC(),
+	}
+	return m.lastID, nil
+}
+
+// Authenticate verifies a user exists with the specified password and returns their user ID and name
+// If not found or the wrong password is given then it returns the error models.ErrInvalidCredentials
+func (m *UserModel) Authenticate(email, password string) (int, string, error) {
+	var found *models.User
+	m.mu.RLock()
+	for _, user := range m.users {
+		if user.Email == email {
+			found = user
+			break
+		}
+	}
+	m.mu.RUnlock()
+	if found == nil {
+		return 0, "", models.ErrInvalidCredentials
+	}
+
+	// Stored users are never modified so it is safe to use found after releasing the lock
+	err := bcrypt.CompareHashAndPassword(found.HashedPassword, []byte(password))
+	if err == bcrypt.ErrMismatchedHashAndPassword {
+		return 0, "", models.ErrInvalidCredentials
+	} else if err != nil {
+		return 0, "", err
+	}
+
+	return found.ID, found.Name, nil
+}
+
+// Get retrieves user info based on ID or returns nil (and no error) if not found
+// Like the database backends the password hash is not returned.
+func (m *UserModel) Get(id int) (*models.User, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	user, ok := m.users[id]
+	if !ok {
+		return nil, nil
+	}
+	copied := *user
+	copied.HashedPassword = nil
+	return &copied, nil
+}
+
+// GetByEmail retrieves user info based on their email address or returns nil (and no error) if not found
+func (m *UserModel) GetByEmail(email string) (*models.User, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	for _, user := range m.users {
+		if user.Email == email {
+			copied := *user
+			copied.HashedPassword = nil
+			return &copied, nil
+		}
+	}
+	return nil, nil
+}
+
+// NewToken adds a one-time token for a purpose (eg models.TokenVerify) that a user (ID) can use until it
+// expires (after lifetime).  It returns the token, but only a hash of it is stored (same as the
+// database backends).  Any of the user's tokens that have expired are deleted.
+func (m *UserModel) NewToken(userID int, purpose string, lifetime time.Duration) (string, error) {
+	value, hash, err := models.NewToken()
+	if err != nil {
+		return "", err
+	}
+	now := time.Now()
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for h, t := range m.tokens {
+		if t.userID == userID && !t.expires.After(now) {
+			delete(m.tokens, h)
+		}
+	}
+	m.tokens[hash] = &token{userID: userID, purpose: purpose, expires: now.Add(lifetime)}
+	return value, nil
+}
+
+// useToken finds the user that a token was created for (see NewToken) and deletes all the user's
+// tokens for the same purpose so that it can't be used again.  It returns models.ErrInvalidToken if
+// the token is not found, has expired or is for another purpose.  The caller must hold the lock.
+func (m *UserModel) useToken(value, purpose string) (*models.User, error) {
+	t, ok := m.tokens[models.HashToken(value)]
+	if !ok || t.purpose != purpose || !t.expires.After(time.Now()) {
+		return nil, models.ErrInvalidToken
+	}
+	for h, other := range m.tokens {
+		if other.userID == t.userID && other.purpose == purpose {
+			delete(m.tokens, h)
+		}
+	}
+	user, ok := m.users[t.userID]
+	if !ok {
+		return nil, models.ErrInvalidToken
+	}
+	return user, nil
+}
+
+// Verify marks the user that a (models.TokenVerify) token was emailed to as having verified their email
+// address and returns their ID.  It returns models.ErrInvalidToken if the token is not valid.
+func (m *UserModel) Verify(value string) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	user, err := m.useToken(value, models.TokenVerify)
+	if err != nil {
+		return 0, err
+	}
+
+	verified := *user
+	verified.Verified = true
+	m.users[user.ID] = &verified
+	return user.ID, nil
+}
+
+// ResetPassword sets a new password for the user that a (models.TokenReset) token was emailed to and
+// returns their ID.  It also marks their email address as verified (as they received the email) and
+// changes their SessionVersion to end their other sessions.  It returns models.ErrInvalidToken if the
+// token is not valid.
+func (m *UserModel) ResetPassword(value, password string) (int, error) {
+	bCryptCost := 12
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), bCryptCost)
+	if err != nil {
+		return 0, err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	user, err := m.useToken(value, models.TokenReset)
+	if err != nil {
+		return 0, err
+	}
+
+	reset := *user
+	reset.HashedPassword = hashedPassword
+	reset.Verified = true
+	reset.SessionVersion++
+	m.users[user.ID] = &reset
+	return user.ID, nil
+}
+
+// update replaces a stored user with a modified copy (so stored users are never modified).  It
+// does nothing if the user is not found.  The caller must hold the lock.
+func (m *UserModel) update(id int, modify func(user *models.User)) {
+	user, ok := m.users[id]
+	if !ok {
+		return
+	}
+	copied := *user
+	modify(&copied)
+	m.users[id] = &copied
+}
+
+// UpdateName changes the name of a user
+func (m *UserModel) UpdateName(id int, name string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.update(id, func(user *models.User) { user.Name = name })
+	return nil
+}
+
+// UpdateEmail changes the email address of a user, who must then verify the new address (see Verify).  Any
+// tokens emailed to the old address are deleted so they can't be used for the new one.  It returns
+// models.ErrDuplicateEmail if the address is already in use.
+func (m *UserModel) UpdateEmail(id int, email string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, user := range m.users {
+		if user.Email == email && user.ID != id {
+			return models.ErrDuplicateEmail
+		}
+	}
+	m.update(id, func(user *models.User) {
+		user.Email = email
+		user.Verified = false
+	})
+	for h, t := range m.tokens {
+		if t.userID == id {
+			delete(m.tokens, h)
+		}
+	}
+	return nil
+}
+
+// ChangePassword sets a new password for a user if the current one is given, otherwise it returns
+// models.ErrInvalidCredentials.  It also changes their SessionVersion to end their other sessions.
+func (m *UserModel) ChangePassword(id int, current, password string) error {
+	m.mu.RLock()
+	found, ok := m.users[id]
+	m.mu.RUnlock()
+	if !ok {
+		return models.ErrInvalidCredentials
+	}
+
+	// Stored users are never modified so it is safe to use found after releasing the lock
+	err := bcrypt.CompareHashAndPassword(found.HashedPassword, []byte(current))
+	if err == bcrypt.ErrMismatchedHashAndPassword {
+		return models.ErrInvalidCredentials
+	} else if err != nil {
+		return err
+	}
+	bCryptCost := 12
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), bCryptCost)
+	if err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.update(id, func(user *models.User) {
+		user.HashedPassword = hashedPassword
+		user.SessionVersion++
+	})
+	return nil
+}
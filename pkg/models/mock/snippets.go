@@ -1,41 +0,0 @@
-package mock
-
-import (
-	"time"
-
-	"github.com/andrewwphillips/snippetbox/pkg/models"
-)
-
-var mockSnippet = &models.Snippet{
-	ID:      1,
-	Title:   "An old silent pond",
-	Content: "An old silent pond...",
-	Created: time.Now(),
-	Expires: time.Now(),
-}
-
-type SnippetModel struct{}
-
-func NewSnippetModel(dsn string) *SnippetModel {
-	return &SnippetModel{}
-}
-
-func (m *SnippetModel) Close() {
-}
-
-func (m *SnippetModel) Insert(title, content, expires string) (int, error) {
-	return 2, nil
-}
-
-func (m *SnippetModel) Get(id int) (*models.Snippet, error) {
-	switch id {
-	case 1:
-		return mockSnippet, nil
-	default:
-		return nil, nil
-	}
-}
-
-func (m *SnippetModel) Latest() ([]*models.Snippet, error) {
-	return []*models.Snippet{mockSnippet}, nil
-}
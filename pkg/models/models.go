@@ -1,23 +1,116 @@
 package models
 
 import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
 	"errors"
+	"strings"
 	"time"
+	"unicode"
 )
 
 // Snippet holds data from one record of the "snippets" table of the snippetbox database
 type Snippet struct {
-	ID      int
-	Title   string
-	Content string
+	ID               int
+	Slug             string // random string used in the snippet's URL so that snippets can't be found by counting
+	UserID           int    // ID of the user that created the snippet (zero if not known)
+	Author           string // name of the user that created the snippet
+	Title            string
+	Content          string
+	Language         string // used for syntax highlighting, eg "go" (empty for plain text)
+	Visibility       string // who can see the snippet - Public, Unlisted or Private
+	BurnAfterReading bool   // delete the snippet when first read by someone other than its author (see SnippetStore.Burn)
+	Protected        bool   // a password is needed to view the snippet (see SnippetStore.Unlock) - the hash is never returned
+	Created          time.Time
+	Expires          time.Time
+}
+
+// Never is the expiry time of snippets that never expire.  It is a real (far future) time, rather
+// than eg a NULL expiry, so that stores can treat all snippets the same way.
+var Never = time.Date(9999, 12, 31, 0, 0, 0, 0, time.UTC)
+
+// slugBytes is the number of random bytes in a slug (encoded as 12 URL-safe characters)
+const slugBytes = 9
+
+// NewSlug returns a new random slug for a snippet.  With 72 random bits a clash with an existing
+// slug is so unlikely that stores can simply report it as an error (from a unique index).
+func NewSlug() (string, error) {
+	b := make([]byte, slugBytes)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// Visibility levels of a snippet
+const (
+	Public   = "public"   // listed (eg on the home page) and in search results
+	Unlisted = "unlisted" // can be viewed by anyone with the link but is not listed or searched
+	Private  = "private"  // can only be viewed by its owner
+)
+
+// OwnedBy returns true if the snippet was created by a user (ID), where a userID of zero means
+// nobody is logged in
+func (s *Snippet) OwnedBy(userID int) bool {
+	return userID != 0 && userID == s.UserID
+}
+
+// VisibleTo returns true if the snippet can be viewed by a user (ID), where a userID of zero
+// means nobody is logged in
+func (s *Snippet) VisibleTo(userID int) bool {
+	return s.Visibility != Private || s.OwnedBy(userID)
+}
+
+// Listed returns true if the snippet can be shown in lists of snippets (eg the home page and search
+// results).  Snippets that are burned after reading or need a password are not listed, as a list (or
+// search) could reveal their content.
+func (s *Snippet) Listed() bool {
+	return s.Visibility == Public && !s.BurnAfterReading && !s.Protected
+}
+
+// Cursor is a position in the list of (unexpired, public) snippets, ordered newest first, for keyset
+// pagination.  It is the creation time (UTC) and ID of the last snippet seen.  The zero Cursor is
+// the start of the list.
+type Cursor struct {
 	Created time.Time
-	Expires time.Time
+	ID      int
+	Newer   bool // get the snippets just newer than the cursor (previous page) rather than older (next page)
+}
+
+// SearchTerms splits a search query into words (lower case, without duplicates).  Punctuation
+// is ignored so that the words can be used safely by any backend.  A snippet matches a search
+// if its title or content contains all the words.
+func SearchTerms(query string) []string {
+	var terms []string
+	seen := make(map[string]bool)
+	for _, term := range strings.FieldsFunc(strings.ToLower(query), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	}) {
+		if !seen[term] {
+			seen[term] = true
+			terms = append(terms, term)
+		}
+	}
+	return terms
+}
+
+// Revision holds one version of a snippet from the "snippet_revisions" table.  Revision 1 is
+// the snippet as first created and a new revision is added every time the snippet is updated.
+type Revision struct {
+	SnippetID int
+	Number    int
+	Title     string
+	Content   string
+	Created   time.Time
 }
 
 var (
 	// Errors relating to the user table (logins)
 	ErrInvalidCredentials = errors.New("models: invalid credentials")
 	ErrDuplicateEmail     = errors.New("models: duplicate email")
+	ErrInvalidToken       = errors.New("models: invalid or expired token")
 )
 
 // User holds data from one record of the "users" table of the snippetbox database
@@ -26,5 +119,34 @@ type User struct {
 	Name           string
 	Email          string
 	HashedPassword []byte
+	Verified       bool // the user has shown that the email address is theirs (see UserStore.Verify)
+	SessionVersion int  // changed to end all the user's sessions, eg when their password is reset
 	Created        time.Time
 }
+
+// Purposes of the one-time tokens that are emailed to users (see UserStore.NewToken)
+const (
+	TokenVerify = "verify" // verify the user's email address
+	TokenReset  = "reset"  // set a new password (see UserStore.ResetPassword)
+)
+
+// tokenBytes is the number of random bytes in a token (encoded as 43 URL-safe characters)
+const tokenBytes = 32
+
+// NewToken returns a new random token to email to a user and its hash (see HashToken)
+func NewToken() (token, hash string, err error) {
+	b := make([]byte, tokenBytes)
+	if _, err = rand.Read(b); err != nil {
+		return "", "", err
+	}
+	token = base64.RawURLEncoding.EncodeToString(b)
+	return token, HashToken(token), nil
+}
+
+// HashToken returns the hash (64 hex digits) of a token.  Stores only keep the hash so that
+// tokens can't be used by anyone that gets a copy of the database.  (Unlike passwords, tokens
+// are random enough that a fast hash is safe.)
+func HashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
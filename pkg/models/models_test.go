@@ -0,0 +1,67 @@
+package models
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// TestSearchTerms checks that search queries are split into distinct lower case words
+func TestSearchTerms(t *testing.T) {
+	tests := []struct {
+		query string
+		want  []string
+	}{
+		{"", nil},
+		{"frog", []string{"frog"}},
+		{"  Frog   POND ", []string{"frog", "pond"}},
+		{"frog, pond & frog!", []string{"frog", "pond"}},
+		{`+frog -"pond*"`, []string{"frog", "pond"}},
+		{"café 2023", []string{"café", "2023"}},
+		{"!!!", nil},
+	}
+	for _, tt := range tests {
+		if got := SearchTerms(tt.query); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("SearchTerms(%q): want %q; got %q", tt.query, tt.want, got)
+		}
+	}
+}
+
+// TestNewSlug checks that slugs are URL-safe and different each time
+func TestNewSlug(t *testing.T) {
+	seen := make(map[string]bool)
+	for i := 0; i < 100; i++ {
+		slug, err := NewSlug()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(slug) != 12 || strings.Trim(slug, "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789-_") != "" {
+			t.Errorf("slug %q: want 12 URL-safe characters", slug)
+		}
+		if seen[slug] {
+			t.Errorf("slug %q: duplicate", slug)
+		}
+		seen[slug] = true
+	}
+}
+
+// TestNewToken checks that tokens are URL-safe and different each time and that only the token matches its hash
+func TestNewToken(t *testing.T) {
+	seen := make(map[string]bool)
+	for i := 0; i < 100; i++ {
+		token, hash, err := NewToken()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(token) != 43 || strings.Trim(token, "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789-_") != "" {
+			t.Errorf("token %q: want 43 URL-safe characters", token)
+		}
+		if hash != HashToken(token) || len(hash) != 64 || hash == HashToken(token+"x") {
+			t.Errorf("token %q: hash %q does not match", token, hash)
+		}
+		if seen[token] {
+			t.Errorf("token %q: duplicate", token)
+		}
+		seen[token] = true
+	}
+}
@@ -0,0 +1,20 @@
+-- IF NOT EXISTS allows this to be applied to a database created before migrations were used
+CREATE TABLE IF NOT EXISTS snippets
+(
+    id      INTEGER      NOT NULL PRIMARY KEY AUTO_INCREMENT,
+    title   VARCHAR(100) NOT NULL,
+    content TEXT         NOT NULL,
+    created DATETIME     NOT NULL,
+    expires DATETIME     NOT NULL,
+    INDEX idx_snippets_created (created)
+);
+
+CREATE TABLE IF NOT EXISTS users
+(
+    id              INTEGER      NOT NULL PRIMARY KEY AUTO_INCREMENT,
+    name            VARCHAR(255) NOT NULL,
+    email           VARCHAR(255) NOT NULL,
+    hashed_password CHAR(60)     NOT NULL,
+    created         DATETIME     NOT NULL,
+    CONSTRAINT users_uc_email UNIQUE (email)
+);
@@ -0,0 +1,6 @@
+-- Existing snippets have no known author so user_id is NULL for them
+ALTER TABLE snippets
+    ADD COLUMN user_id INTEGER NULL;
+
+ALTER TABLE snippets
+    ADD CONSTRAINT fk_snippets_user FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE SET NULL;
@@ -0,0 +1,2 @@
+-- Search (see SnippetModel.Search) uses MATCH(title, content) which needs a FULLTEXT index on the same columns
+CREATE FULLTEXT INDEX idx_snippets_search ON snippets (title, content);
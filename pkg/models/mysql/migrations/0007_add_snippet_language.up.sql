@@ -0,0 +1,3 @@
+-- The language (eg "go") used for syntax highlighting or empty for plain text
+ALTER TABLE snippets
+    ADD COLUMN language VARCHAR(20) NOT NULL DEFAULT '';
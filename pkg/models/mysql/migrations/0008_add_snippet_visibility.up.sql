@@ -0,0 +1,3 @@
+-- Who can see a snippet: 'public' (listed), 'unlisted' (anyone with the link) or 'private' (owner only)
+ALTER TABLE snippets
+    ADD COLUMN visibility VARCHAR(10) NOT NULL DEFAULT 'public';
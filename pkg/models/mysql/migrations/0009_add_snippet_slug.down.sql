@@ -0,0 +1,5 @@
+ALTER TABLE snippets
+    DROP INDEX snippets_uc_slug;
+
+ALTER TABLE snippets
+    DROP COLUMN slug;
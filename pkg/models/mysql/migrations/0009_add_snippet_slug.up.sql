@@ -0,0 +1,10 @@
+-- A random string used in the URL of a snippet (instead of its ID) so that snippets can't be
+-- found by counting.  Existing snippets get a random slug of 16 hex digits.
+ALTER TABLE snippets
+    ADD COLUMN slug VARCHAR(16) NOT NULL DEFAULT '';
+
+UPDATE snippets
+SET slug = LOWER(HEX(RANDOM_BYTES(8)));
+
+ALTER TABLE snippets
+    ADD CONSTRAINT snippets_uc_slug UNIQUE (slug);
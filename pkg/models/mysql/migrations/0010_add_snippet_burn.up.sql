@@ -0,0 +1,3 @@
+-- Snippets to be deleted when first read by someone other than their author
+ALTER TABLE snippets
+    ADD COLUMN burn_after_reading BOOLEAN NOT NULL DEFAULT FALSE;
@@ -0,0 +1,3 @@
+-- Hash (bcrypt) of the password needed to view a snippet - NULL if it is not protected
+ALTER TABLE snippets
+    ADD COLUMN hashed_password CHAR(60);
@@ -0,0 +1,85 @@
+package mysql
+
+import (
+	"database/sql"
+	"embed"
+	"io/fs"
+
+	"github.com/andrewwphillips/snippetbox/pkg/migrate"
+	"github.com/andrewwphillips/snippetbox/pkg/models"
+)
+
+// init registers this package as the "mysql" storage backend
+func init() {
+	models.Register("mysql", open)
+	migrate.Register("mysql", openMigrator)
+}
+
+// migrationFiles contains the SQL scripts used to create and upgrade the database tables
+//
+//go:embed migrations/*.sql
+var migrationFiles embed.FS
+
+// Make sure the models implement all the methods required by the app
+var (
+	_ models.SnippetStore = (*SnippetModel)(nil)
+	_ models.UserStore    = (*UserModel)(nil)
+)
+
+// openDB returns a connection pool for the MySQL database, checking that it can be reached
+func openDB(dsn string) (*sql.DB, error) {
+	// Add parseTime to the DSN so that time.Time (Created, Expires etc) fields are translated correctly
+	db, err := sql.Open("mysql", dsn+"?parseTime=true")
+	if err != nil {
+		return nil, err
+	}
+	if err = db.Ping(); err != nil {
+		db.Close()
+		return nil, err
+	}
+	return db, nil
+}
+
+// open is the models.Backend function that creates the snippet and user stores
+func open(dsn string) (models.SnippetStore, models.UserStore, error) {
+	snippetDB, err := openDB(dsn)
+	if err != nil {
+		return nil, nil, err
+	}
+	userDB, err2 := openDB(dsn)
+	if err2 != nil {
+		snippetDB.Close()
+		return nil, nil, err2
+	}
+	return &SnippetModel{DB: snippetDB}, &UserModel{DB: userDB}, nil
+}
+
+// newMigrator returns a migrate.Migrator for updating the tables of db to the latest version
+func newMigrator(db *sql.DB) (*migrate.Migrator, error) {
+	dir, err := fs.Sub(migrationFiles, "migrations")
+	if err != nil {
+		return nil, err
+	}
+	migrations, err2 := migrate.Load(dir)
+	if err2 != nil {
+		return nil, err2
+	}
+	return &migrate.Migrator{
+		DB:         db,
+		Migrations: migrations,
+	}, nil
+}
+
+// openMigrator returns a migrate.Migrator for the database given by dsn
+func openMigrator(dsn string) (*migrate.Migrator, error) {
+	db, err := openDB(dsn)
+	if err != nil {
+		return nil, err
+	}
+	m, err2 := newMigrator(db)
+	if err2 != nil {
+		db.Close()
+		return nil, err2
+	}
+	return m, nil
+}
@@ -18,7 +18,16 @@ func newTestDB(t *testing.T) (*sql.DB, func()) {
 		t.Fatal(err)
 	}
 
-	// Run the setup SQL script to create test tables and add test data
+	// Create the tables by applying all the migrations (the same as "migrate up")
+	m, err := newMigrator(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = m.Up(); err != nil {
+		t.Fatal(err)
+	}
+
+	// Run the setup SQL script to add test data
 	script, err := os.ReadFile("./testdata/setup.sql")
 	if err != nil {
 		t.Fatal(err)
@@ -30,6 +39,16 @@ func newTestDB(t *testing.T) (*sql.DB, func()) {
 
 	// Return the connection pool and teardown function (to delete the test tables and close connection)
 	return db, func() {
+		// Revert all the migrations then remove the table used to track them
+		for {
+			reverted, err := m.Down()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if reverted == nil {
+				break
+			}
+		}
 		script, err := os.ReadFile("./testdata/teardown.sql")
 		if err != nil {
 			t.Fatal(err)
@@ -0,0 +1,21 @@
+-- IF NOT EXISTS allows this to be applied to a database created before migrations were used
+CREATE TABLE IF NOT EXISTS snippets
+(
+    id      SERIAL       NOT NULL PRIMARY KEY,
+    title   VARCHAR(100) NOT NULL,
+    content TEXT         NOT NULL,
+    created TIMESTAMP    NOT NULL,
+    expires TIMESTAMP    NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_snippets_created ON snippets (created);
+
+CREATE TABLE IF NOT EXISTS users
+(
+    id              SERIAL       NOT NULL PRIMARY KEY,
+    name            VARCHAR(255) NOT NULL,
+    email           VARCHAR(255) NOT NULL,
+    hashed_password CHAR(60)     NOT NULL,
+    created         TIMESTAMP    NOT NULL,
+    CONSTRAINT users_uc_email UNIQUE (email)
+);
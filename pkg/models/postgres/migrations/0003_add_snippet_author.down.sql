@@ -0,0 +1,2 @@
+ALTER TABLE snippets
+    DROP COLUMN user_id;
@@ -0,0 +1,15 @@
+CREATE TABLE snippet_revisions
+(
+    snippet_id INTEGER      NOT NULL,
+    revision   INTEGER      NOT NULL,
+    title      VARCHAR(100) NOT NULL,
+    content    TEXT         NOT NULL,
+    created    TIMESTAMP     NOT NULL,
+    PRIMARY KEY (snippet_id, revision),
+    CONSTRAINT fk_revisions_snippet FOREIGN KEY (snippet_id) REFERENCES snippets (id) ON DELETE CASCADE
+);
+
+-- The current version of each existing snippet becomes its first revision
+INSERT INTO snippet_revisions (snippet_id, revision, title, content, created)
+SELECT id, 1, title, content, created
+FROM snippets;
@@ -0,0 +1,2 @@
+-- Search (see SnippetModel.Search) must use the same expression to use this index
+CREATE INDEX idx_snippets_search ON snippets USING GIN (to_tsvector('english', title || ' ' || content));
@@ -0,0 +1,19 @@
+-- Users must show that their email address is theirs (existing users are assumed to have done so)
+ALTER TABLE users
+    ADD COLUMN verified BOOLEAN NOT NULL DEFAULT FALSE;
+
+UPDATE users
+SET verified = TRUE;
+
+-- One-time tokens emailed to users (eg to verify their email address).  Only a hash (SHA-256 hex)
+-- of each token is stored.
+CREATE TABLE user_tokens
+(
+    hash    CHAR(64)    NOT NULL PRIMARY KEY,
+    user_id INTEGER     NOT NULL,
+    purpose VARCHAR(10) NOT NULL,
+    expires TIMESTAMP   NOT NULL,
+    CONSTRAINT fk_user_tokens_user FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE
+);
+
+CREATE INDEX idx_user_tokens_user ON user_tokens (user_id);
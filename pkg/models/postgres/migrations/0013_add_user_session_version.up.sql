@@ -0,0 +1,3 @@
+-- Incremented to log a user out of all their sessions (eg after their password is reset)
+ALTER TABLE users
+    ADD COLUMN session_version INTEGER NOT NULL DEFAULT 0;
@@ -0,0 +1,2 @@
+DROP INDEX idx_snippets_search;
+CREATE INDEX idx_snippets_search ON snippets USING GIN (to_tsvector('english', title || ' ' || content));
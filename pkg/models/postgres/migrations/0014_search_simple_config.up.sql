@@ -0,0 +1,3 @@
+-- The simple configuration matches whole words (the english one stems words and drops stopwords)
+DROP INDEX idx_snippets_search;
+CREATE INDEX idx_snippets_search ON snippets USING GIN (to_tsvector('simple', title || ' ' || content));
@@ -0,0 +1,457 @@
+package postgres
+
+import (
+	"database/sql"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/andrewwphillips/snippetbox/pkg/models"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// SnippetModel wraps a sql.DB connection pool and provides methods to operate on the snippets table
+type SnippetModel struct {
+	DB *sql.DB
+}
+
+// NewSnippetModel creates a SnippetModel for manipulating the snippets database table
+func NewSnippetModel(dsn string) *SnippetModel {
+	db, err := openDB(dsn)
+	if err != nil {
+		log.Fatal(err)
+	}
+	return &SnippetModel{DB: db}
+}
+
+func (m *SnippetModel) Close() {
+	m.DB.Close()
+}
+
+// selectSnippets is the first part of a query for snippets (see scanSnippet) including the author's name
+// Snippets created before the user_id column was added have no author so user_id may be NULL.
+const selectSnippets = "SELECT s.id, s.slug, s.title, s.content, s.language, s.visibility, s.burn_after_reading, s.hashed_password IS NOT NULL, s.created, s.expires, COALESCE(s.user_id, 0), COALESCE(u.name, '') " +
+	"FROM snippets s LEFT JOIN users u ON u.id = s.user_id "
+
+// scanSnippet gets the fields of a row returned by a selectSnippets query
+func scanSnippet(row interface{ Scan(...interface{}) error }) (*models.Snippet, error) {
+	s := &models.Snippet{}
+	err := row.Scan(&s.ID, &s.Slug, &s.Title, &s.Content, &s.Language, &s.Visibility, &s.BurnAfterReading, &s.Protected, &s.Created, &s.Expires, &s.UserID, &s.Author)
+	if err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// querySnippets returns all the snippets found by a selectSnippets query
+func (m *SnippetModel) querySnippets(query string, args ...interface{}) ([]*models.Snippet, error) {
+	rows, err := m.DB.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	snippets := []*models.Snippet{}
+	for rows.Next() {
+		s, err := scanSnippet(rows)
+		if err != nil {
+			return nil, err
+		}
+		snippets = append(snippets, s)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return snippets, nil
+}
+
+// addRevision saves the current title and content of a snippet as a revision.  The time
+// is either "created" (the snippet's creation time, for the first revision) or "now".
+func addRevision(tx *sql.Tx, snippetID, number int, when string) error {
+	created := "created"
+	if when == "now" {
+		created = "NOW() AT TIME ZONE 'UTC'"
+	}
+	query := "INSERT " +
+		"INTO snippet_revisions (snippet_id, revision, title, content, created) " +
+		"SELECT id, $1::INTEGER, title, content, " + created + " FROM snippets WHERE id = $2 "
+
+	_, err := tx.Exec(query, number, snippetID)
+	return err
+}
+
+// Insert adds a new snippet to the database, recording the user (ID) that created it.
+// The snippet is kept until the expires time (models.Never for ever).
+// Times are stored as UTC in TIMESTAMP (without time zone) columns like the MySQL DATETIME columns.
+// If password is not empty a hash of it is stored and it is needed to view the snippet (see Unlock).
+// The snippet as created is also saved as its first revision.  It returns the ID and (new random)
+// slug of the snippet.
+func (m *SnippetModel) Insert(userID int, title, content, language, visibility string, expires time.Time, password string, burn bool) (int, string, error) {
+	query := "INSERT " +
+		"INTO snippets (slug, user_id, title, content, language, visibility, burn_after_reading, hashed_password, created, expires) " +
+		"VALUES($1, $2, $3, $4, $5, $6, $7, $8, NOW() AT TIME ZONE 'UTC', $9) " +
+		"RETURNING id "
+
+	slug, err := models.NewSlug()
+	if err != nil {
+		return 0, "", err
+	}
+	var hashedPassword sql.NullString // NULL if the snippet is not protected
+	if password != "" {
+		bCryptCost := 12
+		hash, err := bcrypt.GenerateFromPassword([]byte(password), bCryptCost)
+		if err != nil {
+			return 0, "", err
+		}
+		hashedPassword = sql.NullString{String: string(hash), Valid: true}
+	}
+
+	tx, err := m.DB.Begin()
+	if err != nil {
+		return 0, "", err
+	}
+	defer tx.Rollback() // no effect after Commit
+
+	// PostgreSQL does not support LastInsertId so the new ID is obtained using RETURNING
+	var id int
+	if err = tx.QueryRow(query, slug, userID, title, content, language, visibility, burn, hashedPassword, expires.UTC()).Scan(&id); err != nil {
+		return 0, "", err
+	}
+
+	if err = addRevision(tx, id, 1, "created"); err != nil {
+		return 0, "", err
+	}
+	if err = tx.Commit(); err != nil {
+		return 0, "", err
+	}
+
+	return id, slug, nil
+}
+
+// Get returns a snippet as long as it has not expired, whatever its visibility (see Snippet.VisibleTo)
+// If the snippet is found it is returned (and error return is nil)
+// If the snippet is NOT found it returns nil for the snippet AND the error.
+// It returns an error (and nil snippet) if there was some real error.
+func (m *SnippetModel) Get(id int) (*models.Snippet, error) {
+	query := selectSnippets +
+		"WHERE s.expires > NOW() AT TIME ZONE 'UTC' AND s.id = $1 "
+
+	s, err := scanSnippet(m.DB.QueryRow(query, id))
+	if err == sql.ErrNoRows {
+		return nil, nil // not an error - just snippet not found
+	} else if err != nil {
+		return nil, err
+	}
+
+	return s, nil
+}
+
+// GetBySlug is like Get but finds the snippet using its slug
+func (m *SnippetModel) GetBySlug(slug string) (*models.Snippet, error) {
+	query := selectSnippets +
+		"WHERE s.expires > NOW() AT TIME ZONE 'UTC' AND s.slug = $1 "
+
+	s, err := scanSnippet(m.DB.QueryRow(query, slug))
+	if err == sql.ErrNoRows {
+		return nil, nil // not an error - just snippet not found
+	} else if err != nil {
+		return nil, err
+	}
+
+	return s, nil
+}
+
+// Unlock checks the password of a protected snippet.  It returns models.ErrInvalidCredentials if the
+// snippet is not found or the password is wrong, and nil if it is right or the snippet has no password.
+func (m *SnippetModel) Unlock(id int, password string) error {
+	query := "SELECT hashed_password " +
+		"FROM snippets " +
+		"WHERE expires > NOW() AT TIME ZONE 'UTC' AND id = $1 "
+
+	var hashedPassword []byte // nil if NULL (not protected)
+	err := m.DB.QueryRow(query, id).Scan(&hashedPassword)
+	if err == sql.ErrNoRows {
+		return models.ErrInvalidCredentials
+	} else if err != nil {
+		return err
+	}
+	if hashedPassword == nil {
+		return nil
+	}
+
+	err = bcrypt.CompareHashAndPassword(hashedPassword, []byte(password))
+	if err == bcrypt.ErrMismatchedHashAndPassword {
+		return models.ErrInvalidCredentials
+	}
+	return err
+}
+
+// Burn gets a snippet and deletes it in one transaction so that only one caller gets it.  It
+// returns nil (and no error) if the snippet is not found, eg if it has already been burned.
+func (m *SnippetModel) Burn(id int) (*models.Snippet, error) {
+	// FOR UPDATE locks the snippet (but not the author) so that another Burn of it waits (then
+	// finds it has gone)
+	query := selectSnippets +
+		"WHERE s.expires > NOW() AT TIME ZONE 'UTC' AND s.id = $1 " +
+		"FOR UPDATE OF s "
+
+	tx, err := m.DB.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback() // no effect after Commit
+
+	s, err := scanSnippet(tx.QueryRow(query, id))
+	if err == sql.ErrNoRows {
+		return nil, nil // not an error - just snippet not found
+	} else if err != nil {
+		return nil, err
+	}
+	if _, err = tx.Exec("DELETE FROM snippets WHERE id = $1", id); err != nil {
+		return nil, err
+	}
+	if err = tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	return s, nil
+}
+
+// Page returns up to limit (unexpired, public) snippets, newest first, that are older than the cursor,
+// or if cursor.Newer is set the (up to limit) snippets just newer than the cursor.  The zero
+// Cursor gets the latest snippets.  The (created, id) order uses the idx_snippets_created index.
+func (m *SnippetModel) Page(cursor models.Cursor, limit int) ([]*models.Snippet, error) {
+	return m.page("", nil, cursor, limit)
+}
+
+// Search is like Page but only gets snippets whose title or content contain all the words of
+// the query (see models.SearchTerms).  Words are matched using the simple text search
+// configuration (which, unlike english, doesn't stem words or drop stopwords like "the") and
+// the idx_snippets_search index.
+func (m *SnippetModel) Search(query string, cursor models.Cursor, limit int) ([]*models.Snippet, error) {
+	terms := models.SearchTerms(query)
+	if len(terms) == 0 {
+		return []*models.Snippet{}, nil
+	}
+
+	// The to_tsvector expression must be the same as that of the index (see migrations)
+	filter := "AND to_tsvector('simple', s.title || ' ' || s.content) @@ plainto_tsquery('simple', $1) "
+	return m.page(filter, []interface{}{strings.Join(terms, " ")}, cursor, limit)
+}
+
+// page gets a page of listed snippets (see models.Snippet.Listed) that also match the filter - a condition starting with
+// AND (or empty for all snippets) with placeholders ($1, $2 etc) for args
+func (m *SnippetModel) page(filter string, args []interface{}, cursor models.Cursor, limit int) ([]*models.Snippet, error) {
+	// arg adds a query argument and returns its placeholder
+	arg := func(v interface{}) string {
+		args = append(args, v)
+		return "$" + strconv.Itoa(len(args))
+	}
+
+	query := selectSnippets +
+		"WHERE s.expires > NOW() AT TIME ZONE 'UTC' AND s.visibility = 'public' AND NOT s.burn_after_reading AND s.hashed_password IS NULL " + filter
+	order := "ORDER BY s.created DESC, s.id DESC "
+
+	newer := cursor.ID != 0 && cursor.Newer
+	if newer {
+		// Get the snippets closest to the cursor (oldest first) then reverse them
+		created, id := arg(cursor.Created), arg(cursor.ID)
+		query += "AND (s.created > " + created + " OR (s.created = " + created + " AND s.id > " + id + ")) "
+		order = "ORDER BY s.created, s.id "
+	} else if cursor.ID != 0 {
+		created, id := arg(cursor.Created), arg(cursor.ID)
+		query += "AND (s.created < " + created + " OR (s.created = " + created + " AND s.id < " + id + ")) "
+	}
+
+	snippets, err := m.querySnippets(query+order+"LIMIT "+arg(limit)+" ", args...)
+	if err != nil {
+		return nil, err
+	}
+	if newer {
+		for i, j := 0, len(snippets)-1; i < j; i, j = i+1, j-1 {
+			snippets[i], snippets[j] = snippets[j], snippets[i]
+		}
+	}
+	return snippets, nil
+}
+
+// ByUser returns all the (unexpired) snippets created by a user, whatever their visibility, newest first
+func (m *SnippetModel) ByUser(userID int) ([]*models.Snippet, error) {
+	query := selectSnippets +
+		"WHERE s.expires > NOW() AT TIME ZONE 'UTC' AND s.user_id = $1 " +
+		"ORDER BY s.created DESC, s.id DESC "
+
+	return m.querySnippets(query, userID)
+}
+
+// Update changes the title, content, language and visibility of a snippet (there is no error if the snippet does not exist)
+// The new version is saved as the next revision of the snippet.
+func (m *SnippetModel) Update(id int, title, content, language, visibility string) error {
+	tx, err := m.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback() // no effect after Commit
+
+	// Lock the snippet row so that concurrent updates don't get the same revision number
+	var locked int
+	err = tx.QueryRow("SELECT id FROM snippets WHERE id = $1 FOR UPDATE", id).Scan(&locked)
+	if err == sql.ErrNoRows {
+		return nil // no such snippet
+	} else if err != nil {
+		return err
+	}
+
+	var last int
+	err = tx.QueryRow("SELECT COALESCE(MAX(revision), 0) FROM snippet_revisions WHERE snippet_id = $1", id).Scan(&last)
+	if err != nil {
+		return err
+	}
+
+	query := "UPDATE snippets " +
+		"SET title = $1, content = $2, language = $3, visibility = $4 " +
+		"WHERE id = $5 "
+	if _, err = tx.Exec(query, title, content, language, visibility, id); err != nil {
+		return err
+	}
+	if err = addRevision(tx, id, last+1, "now"); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// Delete removes a snippet (there is no error if the snippet does not exist)
+func (m *SnippetModel) Delete(id int) error {
+	_, err := m.DB.Exec("DELETE FROM snippets WHERE id = $1", id)
+	return err
+}
+
+// SetTags replaces the tags of a snippet (there is no error if the snippet does not exist).
+// The tags must not contain duplicates (see forms.Tags).
+func (m *SnippetModel) SetTags(snippetID int, tags []string) error {
+	tx, err := m.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback() // no effect after Commit
+
+	if _, err = tx.Exec("DELETE FROM snippet_tags WHERE snippet_id = $1", snippetID); err != nil {
+		return err
+	}
+	for _, tag := range tags {
+		// Add the tag if it's new then link it to the snippet (if the snippet exists)
+		if _, err = tx.Exec("INSERT INTO tags (name) VALUES ($1) ON CONFLICT (name) DO NOTHING", tag); err != nil {
+			return err
+		}
+		query := "INSERT " +
+			"INTO snippet_tags (snippet_id, tag_id) " +
+			"SELECT s.id, t.id FROM snippets s, tags t WHERE s.id = $1 AND t.name = $2 "
+		if _, err = tx.Exec(query, snippetID, tag); err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// Tags returns the tags of a snippet in alphabetical order
+func (m *SnippetModel) Tags(snippetID int) ([]string, error) {
+	query := "SELECT t.name " +
+		"FROM snippet_tags st JOIN tags t ON t.id = st.tag_id " +
+		"WHERE st.snippet_id = $1 " +
+		"ORDER BY t.name "
+
+	rows, err := m.DB.Query(query, snippetID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	tags := []string{}
+	for rows.Next() {
+		var tag string
+		if err = rows.Scan(&tag); err != nil {
+			return nil, err
+		}
+		tags = append(tags, tag)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return tags, nil
+}
+
+// ByTag is like Page but only gets snippets with the tag
+func (m *SnippetModel) ByTag(tag string, cursor models.Cursor, limit int) ([]*models.Snippet, error) {
+	filter := "AND s.id IN (SELECT st.snippet_id FROM snippet_tags st JOIN tags t ON t.id = st.tag_id WHERE t.name = $1) "
+	return m.page(filter, []interface{}{tag}, cursor, limit)
+}
+
+// Revisions returns all the revisions of a snippet, latest first
+func (m *SnippetModel) Revisions(snippetID int) ([]*models.Revision, error) {
+	query := "SELECT snippet_id, revision, title, content, created " +
+		"FROM snippet_revisions " +
+		"WHERE snippet_id = $1 " +
+		"ORDER BY revision DESC "
+
+	rows, err := m.DB.Query(query, snippetID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	revisions := []*models.Revision{}
+	for rows.Next() {
+		rev := &models.Revision{}
+		if err = rows.Scan(&rev.SnippetID, &rev.Number, &rev.Title, &rev.Content, &rev.Created); err != nil {
+			return nil, err
+		}
+		revisions = append(revisions, rev)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return revisions, nil
+}
+
+// Revision returns one revision of a snippet or nil (and no error) if not found
+func (m *SnippetModel) Revision(snippetID, number int) (*models.Revision, error) {
+	query := "SELECT snippet_id, revision, title, content, created " +
+		"FROM snippet_revisions " +
+		"WHERE snippet_id = $1 AND revision = $2 "
+
+	rev := &models.Revision{}
+	err := m.DB.QueryRow(query, snippetID, number).Scan(&rev.SnippetID, &rev.Number, &rev.Title, &rev.Content, &rev.Created)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	return rev, nil
+}
+
+// DeleteExpired deletes up to limit snippets that have expired and returns how many were deleted
+func (m *SnippetModel) DeleteExpired(limit int) (int, error) {
+	// PostgreSQL does not allow LIMIT in a DELETE statement so the IDs are found using a sub-query
+	query := "DELETE " +
+		"FROM snippets " +
+		"WHERE id IN (SELECT id FROM snippets WHERE expires <= NOW() AT TIME ZONE 'UTC' LIMIT $1) "
+
+	result, err := m.DB.Exec(query, limit)
+	if err != nil {
+		return 0, err
+	}
+
+	n, err2 := result.RowsAffected()
+	if err2 != nil {
+		return 0, err2
+	}
+
+	return int(n), nil
+}
@@ -0,0 +1,21 @@
+package postgres
+
+import (
+	"testing"
+
+	"github.com/andrewwphillips/snippetbox/pkg/models"
+	"github.com/andrewwphillips/snippetbox/pkg/models/storetest"
+)
+
+// TestStore runs the storage backend conformance tests
+func TestStore(t *testing.T) {
+	if testing.Short() {
+		t.Skip("postgres: skipping integration test due to use of -short")
+	}
+
+	storetest.Run(t, func(t *testing.T) (models.SnippetStore, models.UserStore) {
+		db, teardown := newTestDB(t)
+		t.Cleanup(teardown)
+		return &SnippetModel{db}, &UserModel{db}
+	})
+}
@@ -0,0 +1,5 @@
+INSERT INTO users (name, email, hashed_password, created)
+VALUES ('Alice Jones',
+        'alice@example.com',
+        '$2a$12$NuTjWXm3KKntReFwyBVHyuf/to.HEwTy.eS206TNfkGfr6HzGJSWG',
+        '2023-03-23 17:25:22');
@@ -0,0 +1 @@
+DROP TABLE schema_migrations;
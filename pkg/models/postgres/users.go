@@ -0,0 +1,281 @@
+package postgres
+
+import (
+	"database/sql"
+	"errors"
+	"log"
+	"time"
+
+	"github.com/andrewwphillips/snippetbox/pkg/models"
+	"github.com/lib/pq"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// uniqueViolation is the PostgreSQL error code (SQLSTATE) for a unique constraint failure
+const uniqueViolation = "23505"
+
+// UserModel provides methods for login system
+type UserModel struct {
+	DB *sql.DB
+}
+
+// NewUserModel creates a UserModel for using the users table
+func NewUserModel(dsn string) *UserModel {
+	db, err := openDB(dsn)
+	if err != nil {
+		log.Fatal(err)
+	}
+	return &UserModel{DB: db}
+}
+
+func (m *UserModel) Close() {
+	m.DB.Close()
+}
+
+// Insert adds a new user
+func (m *UserModel) Insert(name, email, password string) (int, error) {
+	query := "INSERT " +
+		"INTO users (name, email, hashed_password, created) " +
+		"VALUES($1, $2, $3, NOW() AT TIME ZONE 'UTC') " +
+		"RETURNING id "
+
+	bCryptCost := 12
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), bCryptCost)
+	if err != nil {
+		return 0, err
+	}
+
+	var id int
+	if err2 := m.DB.QueryRow(query, name, email, string(hashedPassword)).Scan(&id); err2 != nil {
+		// Check for the special case of an email address being the same as an existing one
+		if duplicateEmail(err2) {
+			return 0, models.ErrDuplicateEmail
+		}
+		return 0, err2
+	}
+
+	return id, nil
+}
+
+// duplicateEmail returns true if an error is for an email address being the same as an existing one
+func duplicateEmail(err error) bool {
+	var pqErr *pq.Error
+	return errors.As(err, &pqErr) && pqErr.Code == uniqueViolation && pqErr.Constraint == "users_uc_email"
+}
+
+// Authenticate verifies a user exists with the specified password and returns their user ID and name
+// If not found or the wrong password is given then it returns the error models.ErrInvalidCredentials
+func (m *UserModel) Authenticate(email, password string) (int, string, error) {
+	var id int
+	var name string
+	var hashedPassword []byte
+	row := m.DB.QueryRow("SELECT id, name, hashed_password FROM users WHERE email = $1", email)
+	err := row.Scan(&id, &name, &hashedPassword)
+	if err == sql.ErrNoRows {
+		return 0, "", models.ErrInvalidCredentials
+	} else if err != nil {
+		return 0, "", err
+	}
+
+	err = bcrypt.CompareHashAndPassword(hashedPassword, []byte(password))
+	if err == bcrypt.ErrMismatchedHashAndPassword {
+		return 0, "", models.ErrInvalidCredentials
+	} else if err != nil {
+		return 0, "", err
+	}
+
+	return id, name, nil
+}
+
+// Get retrieves user info based on ID
+// It returns
+//   - ptr to models.User with data on the user and nil (no error) on success
+//   - nil and an error if something goes wrong
+//   - nil and nil (no error) if the user was not found
+func (m *UserModel) Get(id int) (*models.User, error) {
+	s := &models.User{}
+
+	stmt := `SELECT id, name, email, verified, session_version, created FROM users WHERE id = $1`
+	err := m.DB.QueryRow(stmt, id).Scan(&s.ID, &s.Name, &s.Email, &s.Verified, &s.SessionVersion, &s.Created)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	return s, nil
+}
+
+// GetByEmail retrieves user info based on their email address or returns nil (and no error) if not found
+func (m *UserModel) GetByEmail(email string) (*models.User, error) {
+	s := &models.User{}
+
+	stmt := `SELECT id, name, email, verified, session_version, created FROM users WHERE email = $1`
+	err := m.DB.QueryRow(stmt, email).Scan(&s.ID, &s.Name, &s.Email, &s.Verified, &s.SessionVersion, &s.Created)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	return s, nil
+}
+
+// NewToken adds a one-time token for a purpose (eg models.TokenVerify) that a user (ID) can use until it
+// expires (after lifetime).  It returns the token, to be emailed to the user, but only a hash of it is
+// stored.  Any of the user's tokens that have expired are deleted.
+func (m *UserModel) NewToken(userID int, purpose string, lifetime time.Duration) (string, error) {
+	query := "INSERT " +
+		"INTO user_tokens (hash, user_id, purpose, expires) " +
+		"VALUES($1, $2, $3, NOW() AT TIME ZONE 'UTC' + make_interval(secs => $4)) "
+
+	token, hash, err := models.NewToken()
+	if err != nil {
+		return "", err
+	}
+	if _, err = m.DB.Exec("DELETE FROM user_tokens WHERE user_id = $1 AND expires <= NOW() AT TIME ZONE 'UTC'", userID); err != nil {
+		return "", err
+	}
+	if _, err = m.DB.Exec(query, hash, userID, purpose, lifetime.Seconds()); err != nil {
+		return "", err
+	}
+
+	return token, nil
+}
+
+// useToken finds the user (ID) that a token was created for (see NewToken) and deletes all the user's
+// tokens for the same purpose so that it can't be used again.  It returns models.ErrInvalidToken if the
+// token is not found, has expired or is for another purpose.
+func useToken(tx *sql.Tx, token, purpose string) (int, error) {
+	// FOR UPDATE locks the token so that it can only be used once
+	query := "SELECT user_id " +
+		"FROM user_tokens " +
+		"WHERE hash = $1 AND purpose = $2 AND expires > NOW() AT TIME ZONE 'UTC' " +
+		"FOR UPDATE "
+
+	var userID int
+	err := tx.QueryRow(query, models.HashToken(token), purpose).Scan(&userID)
+	if err == sql.ErrNoRows {
+		return 0, models.ErrInvalidToken
+	} else if err != nil {
+		return 0, err
+	}
+	if _, err = tx.Exec("DELETE FROM user_tokens WHERE user_id = $1 AND purpose = $2", userID, purpose); err != nil {
+		return 0, err
+	}
+
+	return userID, nil
+}
+
+// Verify marks the user that a (models.TokenVerify) token was emailed to as having verified their email
+// address and returns their ID.  It returns models.ErrInvalidToken if the token is not valid.
+func (m *UserModel) Verify(token string) (int, error) {
+	tx, err := m.DB.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback() // no effect after Commit
+
+	userID, err := useToken(tx, token, models.TokenVerify)
+	if err != nil {
+		return 0, err
+	}
+	if _, err = tx.Exec("UPDATE users SET verified = TRUE WHERE id = $1", userID); err != nil {
+		return 0, err
+	}
+	if err = tx.Commit(); err != nil {
+		return 0, err
+	}
+
+	return userID, nil
+}
+
+// ResetPassword sets a new password for the user that a (models.TokenReset) token was emailed to and
+// returns their ID.  It also marks their email address as verified (as they received the email) and
+// changes their SessionVersion to end their other sessions.  It returns models.ErrInvalidToken if the
+// token is not valid.
+func (m *UserModel) ResetPassword(token, password string) (int, error) {
+	bCryptCost := 12
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), bCryptCost)
+	if err != nil {
+		return 0, err
+	}
+
+	tx, err := m.DB.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback() // no effect after Commit
+
+	userID, err := useToken(tx, token, models.TokenReset)
+	if err != nil {
+		return 0, err
+	}
+	query := "UPDATE users " +
+		"SET hashed_password = $1, verified = TRUE, session_version = session_version + 1 " +
+		"WHERE id = $2 "
+	if _, err = tx.Exec(query, string(hashedPassword), userID); err != nil {
+		return 0, err
+	}
+	if err = tx.Commit(); err != nil {
+		return 0, err
+	}
+
+	return userID, nil
+}
+
+// UpdateName changes the name of a user
+func (m *UserModel) UpdateName(id int, name string) error {
+	_, err := m.DB.Exec("UPDATE users SET name = $1 WHERE id = $2", name, id)
+	return err
+}
+
+// UpdateEmail changes the email address of a user, who must then verify the new address (see Verify).  Any
+// tokens emailed to the old address are deleted so they can't be used for the new one.  It returns
+// models.ErrDuplicateEmail if the address is already in use.
+func (m *UserModel) UpdateEmail(id int, email string) error {
+	tx, err := m.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback() // no effect after Commit
+
+	_, err = tx.Exec("UPDATE users SET email = $1, verified = FALSE WHERE id = $2", email, id)
+	if duplicateEmail(err) {
+		return models.ErrDuplicateEmail
+	} else if err != nil {
+		return err
+	}
+	if _, err = tx.Exec("DELETE FROM user_tokens WHERE user_id = $1", id); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// ChangePassword sets a new password for a user if the current one is given, otherwise it returns
+// models.ErrInvalidCredentials.  It also changes their SessionVersion to end their other sessions.
+func (m *UserModel) ChangePassword(id int, current, password string) error {
+	var hashedPassword []byte
+	err := m.DB.QueryRow("SELECT hashed_password FROM users WHERE id = $1", id).Scan(&hashedPassword)
+	if err == sql.ErrNoRows {
+		return models.ErrInvalidCredentials
+	} else if err != nil {
+		return err
+	}
+	err = bcrypt.CompareHashAndPassword(hashedPassword, []byte(current))
+	if err == bcrypt.ErrMismatchedHashAndPassword {
+		return models.ErrInvalidCredentials
+	} else if err != nil {
+		return err
+	}
+
+	bCryptCost := 12
+	if hashedPassword, err = bcrypt.GenerateFromPassword([]byte(password), bCryptCost); err != nil {
+		return err
+	}
+	query := "UPDATE users " +
+		"SET hashed_password = $1, session_version = session_version + 1 " +
+		"WHERE id = $2 "
+	_, err = m.DB.Exec(query, string(hashedPassword), id)
+	return err
+}
@@ -0,0 +1,23 @@
+-- IF NOT EXISTS allows this to be applied to a database created before migrations were used
+-- Note that times are stored as UTC and are always generated in Go (not using SQLite
+-- functions like datetime('now')) so that they are comparable as text.
+CREATE TABLE IF NOT EXISTS snippets
+(
+    id      INTEGER      NOT NULL PRIMARY KEY AUTOINCREMENT,
+    title   VARCHAR(100) NOT NULL,
+    content TEXT         NOT NULL,
+    created DATETIME     NOT NULL,
+    expires DATETIME     NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_snippets_created ON snippets (created);
+
+CREATE TABLE IF NOT EXISTS users
+(
+    id              INTEGER      NOT NULL PRIMARY KEY AUTOINCREMENT,
+    name            VARCHAR(255) NOT NULL,
+    email           VARCHAR(255) NOT NULL,
+    hashed_password CHAR(60)     NOT NULL,
+    created         DATETIME     NOT NULL,
+    CONSTRAINT users_uc_email UNIQUE (email)
+);
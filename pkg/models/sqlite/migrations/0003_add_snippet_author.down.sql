@@ -0,0 +1,4 @@
+DROP INDEX idx_snippets_user;
+
+ALTER TABLE snippets
+    DROP COLUMN user_id;
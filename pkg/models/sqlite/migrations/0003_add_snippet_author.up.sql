@@ -0,0 +1,6 @@
+-- Existing snippets have no known author so user_id is NULL for them
+-- (There is no foreign key constraint as SQLite cannot drop a column that has one.)
+ALTER TABLE snippets
+    ADD COLUMN user_id INTEGER NULL;
+
+CREATE INDEX idx_snippets_user ON snippets (user_id);
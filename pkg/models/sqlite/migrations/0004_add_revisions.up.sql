@@ -0,0 +1,15 @@
+-- Note that deleting a snippet only deletes its revisions if foreign keys are enabled (see connect)
+CREATE TABLE snippet_revisions
+(
+    snippet_id INTEGER      NOT NULL REFERENCES snippets (id) ON DELETE CASCADE,
+    revision   INTEGER      NOT NULL,
+    title      VARCHAR(100) NOT NULL,
+    content    TEXT         NOT NULL,
+    created    DATETIME     NOT NULL,
+    PRIMARY KEY (snippet_id, revision)
+);
+
+-- The current version of each existing snippet becomes its first revision
+INSERT INTO snippet_revisions (snippet_id, revision, title, content, created)
+SELECT id, 1, title, content, created
+FROM snippets;
@@ -0,0 +1,5 @@
+DROP TRIGGER snippets_search_ai;
+DROP TRIGGER snippets_search_bu;
+DROP TRIGGER snippets_search_au;
+DROP TRIGGER snippets_search_bd;
+DROP TABLE snippets_search;
@@ -0,0 +1,12 @@
+-- Full-text index of the snippets table (the text is not stored twice as the content is taken from snippets)
+CREATE VIRTUAL TABLE snippets_search USING fts4(content="snippets", title, content);
+
+-- Triggers keep the index up to date (docid is the snippet ID).  Note that each trigger must be
+-- on one line as migration scripts are split into statements at a semicolon at the end of a line.
+CREATE TRIGGER snippets_search_ai AFTER INSERT ON snippets BEGIN INSERT INTO snippets_search (docid, title, content) VALUES (new.id, new.title, new.content); END;
+CREATE TRIGGER snippets_search_bu BEFORE UPDATE ON snippets BEGIN DELETE FROM snippets_search WHERE docid = old.id; END;
+CREATE TRIGGER snippets_search_au AFTER UPDATE ON snippets BEGIN INSERT INTO snippets_search (docid, title, content) VALUES (new.id, new.title, new.content); END;
+CREATE TRIGGER snippets_search_bd BEFORE DELETE ON snippets BEGIN DELETE FROM snippets_search WHERE docid = old.id; END;
+
+-- Index the existing snippets
+INSERT INTO snippets_search (snippets_search) VALUES ('rebuild');
@@ -0,0 +1,4 @@
+DROP INDEX snippets_uc_slug;
+
+ALTER TABLE snippets
+    DROP COLUMN slug;
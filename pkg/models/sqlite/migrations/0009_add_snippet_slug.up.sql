@@ -0,0 +1,10 @@
+-- A random string used in the URL of a snippet (instead of its ID) so that snippets can't be
+-- found by counting.  Existing snippets get a random slug of 16 hex digits.
+ALTER TABLE snippets
+    ADD COLUMN slug VARCHAR(16) NOT NULL DEFAULT '';
+
+UPDATE snippets
+SET slug = LOWER(HEX(RANDOMBLOB(8)));
+
+-- SQLite can't add a constraint to an existing table but a unique index does the same
+CREATE UNIQUE INDEX snippets_uc_slug ON snippets (slug);
@@ -0,0 +1,440 @@
+package sqlite
+
+import (
+	"database/sql"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/andrewwphillips/snippetbox/pkg/models"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// SnippetModel wraps a sql.DB connection pool and provides methods to operate on the snippets table
+type SnippetModel struct {
+	DB *sql.DB
+}
+
+// NewSnippetModel creates a SnippetModel for manipulating the snippets database table
+func NewSnippetModel(dsn string) *SnippetModel {
+	db, err := openDB(dsn)
+	if err != nil {
+		log.Fatal(err)
+	}
+	return &SnippetModel{DB: db}
+}
+
+func (m *SnippetModel) Close() {
+	m.DB.Close()
+}
+
+// selectSnippets is the first part of a query for snippets (see scanSnippet) including the author's name
+// Snippets created before the user_id column was added have no author so user_id may be NULL.
+const selectSnippets = "SELECT s.id, s.slug, s.title, s.content, s.language, s.visibility, s.burn_after_reading, s.hashed_password IS NOT NULL, s.created, s.expires, COALESCE(s.user_id, 0), COALESCE(u.name, '') " +
+	"FROM snippets s LEFT JOIN users u ON u.id = s.user_id "
+
+// scanSnippet gets the fields of a row returned by a selectSnippets query
+func scanSnippet(row interface{ Scan(...interface{}) error }) (*models.Snippet, error) {
+	s := &models.Snippet{}
+	err := row.Scan(&s.ID, &s.Slug, &s.Title, &s.Content, &s.Language, &s.Visibility, &s.BurnAfterReading, &s.Protected, &s.Created, &s.Expires, &s.UserID, &s.Author)
+	if err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// querySnippets returns all the snippets found by a selectSnippets query
+func (m *SnippetModel) querySnippets(query string, args ...interface{}) ([]*models.Snippet, error) {
+	rows, err := m.DB.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	snippets := []*models.Snippet{}
+	for rows.Next() {
+		s, err := scanSnippet(rows)
+		if err != nil {
+			return nil, err
+		}
+		snippets = append(snippets, s)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return snippets, nil
+}
+
+// addRevision saves the current title and content of a snippet as a revision, using the
+// snippet's creation time (created) for the first revision or else the given time
+func addRevision(tx *sql.Tx, snippetID, number int, created time.Time) error {
+	query := "INSERT " +
+		"INTO snippet_revisions (snippet_id, revision, title, content, created) " +
+		"SELECT id, ?, title, content, ? FROM snippets WHERE id = ? "
+
+	_, err := tx.Exec(query, number, created, snippetID)
+	return err
+}
+
+// Insert adds a new snippet to the database, recording the user (ID) that created it.
+// The snippet is kept until the expires time (models.Never for ever).
+// If password is not empty a hash of it is stored and it is needed to view the snippet (see Unlock).
+// The snippet as created is also saved as its first revision.  It returns the ID and (new random)
+// slug of the snippet.
+func (m *SnippetModel) Insert(userID int, title, content, language, visibility string, expires time.Time, password string, burn bool) (int, string, error) {
+	query := "INSERT " +
+		"INTO snippets (slug, user_id, title, content, language, visibility, burn_after_reading, hashed_password, created, expires) " +
+		"VALUES(?, ?, ?, ?, ?, ?, ?, ?, ?, ?) "
+
+	slug, err := models.NewSlug()
+	if err != nil {
+		return 0, "", err
+	}
+	var hashedPassword sql.NullString // NULL if the snippet is not protected
+	if password != "" {
+		bCryptCost := 12
+		hash, err := bcrypt.GenerateFromPassword([]byte(password), bCryptCost)
+		if err != nil {
+			return 0, "", err
+		}
+		hashedPassword = sql.NullString{String: string(hash), Valid: true}
+	}
+	now := time.Now().UTC()
+
+	tx, err := m.DB.Begin()
+	if err != nil {
+		return 0, "", err
+	}
+	defer tx.Rollback() // no effect after Commit
+
+	result, err2 := tx.Exec(query, slug, userID, title, content, language, visibility, burn, hashedPassword, now, expires.UTC())
+	if err2 != nil {
+		return 0, "", err2
+	}
+
+	id, err3 := result.LastInsertId()
+	if err3 != nil {
+		return 0, "", err3
+	}
+
+	if err = addRevision(tx, int(id), 1, now); err != nil {
+		return 0, "", err
+	}
+	if err = tx.Commit(); err != nil {
+		return 0, "", err
+	}
+
+	return int(id), slug, nil
+}
+
+// Get returns a snippet as long as it has not expired, whatever its visibility (see Snippet.VisibleTo)
+// If the snippet is found it is returned (and error return is nil)
+// If the snippet is NOT found it returns nil for the snippet AND the error.
+// It returns an error (and nil snippet) if there was some real error.
+func (m *SnippetModel) Get(id int) (*models.Snippet, error) {
+	query := selectSnippets +
+		"WHERE s.expires > ? AND s.id = ? "
+
+	s, err := scanSnippet(m.DB.QueryRow(query, time.Now().UTC(), id))
+	if err == sql.ErrNoRows {
+		return nil, nil // not an error - just snippet not found
+	} else if err != nil {
+		return nil, err
+	}
+
+	return s, nil
+}
+
+// GetBySlug is like Get but finds the snippet using its slug
+func (m *SnippetModel) GetBySlug(slug string) (*models.Snippet, error) {
+	query := selectSnippets +
+		"WHERE s.expires > ? AND s.slug = ? "
+
+	s, err := scanSnippet(m.DB.QueryRow(query, time.Now().UTC(), slug))
+	if err == sql.ErrNoRows {
+		return nil, nil // not an error - just snippet not found
+	} else if err != nil {
+		return nil, err
+	}
+
+	return s, nil
+}
+
+// Unlock checks the password of a protected snippet.  It returns models.ErrInvalidCredentials if the
+// snippet is not found or the password is wrong, and nil if it is right or the snippet has no password.
+func (m *SnippetModel) Unlock(id int, password string) error {
+	query := "SELECT hashed_password " +
+		"FROM snippets " +
+		"WHERE expires > ? AND id = ? "
+
+	var hashedPassword []byte // nil if NULL (not protected)
+	err := m.DB.QueryRow(query, time.Now().UTC(), id).Scan(&hashedPassword)
+	if err == sql.ErrNoRows {
+		return models.ErrInvalidCredentials
+	} else if err != nil {
+		return err
+	}
+	if hashedPassword == nil {
+		return nil
+	}
+
+	err = bcrypt.CompareHashAndPassword(hashedPassword, []byte(password))
+	if err == bcrypt.ErrMismatchedHashAndPassword {
+		return models.ErrInvalidCredentials
+	}
+	return err
+}
+
+// Burn gets a snippet and deletes it in one transaction so that only one caller gets it.  It
+// returns nil (and no error) if the snippet is not found, eg if it has already been burned.
+func (m *SnippetModel) Burn(id int) (*models.Snippet, error) {
+	// The transaction locks the database (see connect) so that another Burn waits (then finds the
+	// snippet has gone)
+	query := selectSnippets +
+		"WHERE s.expires > ? AND s.id = ? "
+
+	tx, err := m.DB.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback() // no effect after Commit
+
+	s, err := scanSnippet(tx.QueryRow(query, time.Now().UTC(), id))
+	if err == sql.ErrNoRows {
+		return nil, nil // not an error - just snippet not found
+	} else if err != nil {
+		return nil, err
+	}
+	if _, err = tx.Exec("DELETE FROM snippets WHERE id = ?", id); err != nil {
+		return nil, err
+	}
+	if err = tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	return s, nil
+}
+
+// Page returns up to limit (unexpired, public) snippets, newest first, that are older than the cursor,
+// or if cursor.Newer is set the (up to limit) snippets just newer than the cursor.  The zero
+// Cursor gets the latest snippets.  The (created, id) order uses the idx_snippets_created index.
+func (m *SnippetModel) Page(cursor models.Cursor, limit int) ([]*models.Snippet, error) {
+	return m.page("", nil, cursor, limit)
+}
+
+// Search is like Page but only gets snippets whose title or content contain all the words of
+// the query (see models.SearchTerms) using the snippets_search full-text index
+func (m *SnippetModel) Search(query string, cursor models.Cursor, limit int) ([]*models.Snippet, error) {
+	terms := models.SearchTerms(query)
+	if len(terms) == 0 {
+		return []*models.Snippet{}, nil
+	}
+
+	// FTS matches rows containing all the words (separated by spaces)
+	filter := "AND s.id IN (SELECT docid FROM snippets_search WHERE snippets_search MATCH ?) "
+	return m.page(filter, []interface{}{strings.Join(terms, " ")}, cursor, limit)
+}
+
+// page gets a page of listed snippets (see models.Snippet.Listed) that also match the filter - a condition starting with
+// AND (or empty for all snippets) with placeholders for args
+func (m *SnippetModel) page(filter string, args []interface{}, cursor models.Cursor, limit int) ([]*models.Snippet, error) {
+	query := selectSnippets +
+		"WHERE s.expires > ? AND s.visibility = 'public' AND NOT s.burn_after_reading AND s.hashed_password IS NULL " + filter
+	order := "ORDER BY s.created DESC, s.id DESC "
+	args = append([]interface{}{time.Now().UTC()}, args...)
+
+	newer := cursor.ID != 0 && cursor.Newer
+	if newer {
+		// Get the snippets closest to the cursor (oldest first) then reverse them
+		query += "AND (s.created > ? OR (s.created = ? AND s.id > ?)) "
+		order = "ORDER BY s.created, s.id "
+		args = append(args, cursor.Created, cursor.Created, cursor.ID)
+	} else if cursor.ID != 0 {
+		query += "AND (s.created < ? OR (s.created = ? AND s.id < ?)) "
+		args = append(args, cursor.Created, cursor.Created, cursor.ID)
+	}
+
+	snippets, err := m.querySnippets(query+order+"LIMIT ? ", append(args, limit)...)
+	if err != nil {
+		return nil, err
+	}
+	if newer {
+		for i, j := 0, len(snippets)-1; i < j; i, j = i+1, j-1 {
+			snippets[i], snippets[j] = snippets[j], snippets[i]
+		}
+	}
+	return snippets, nil
+}
+
+// ByUser returns all the (unexpired) snippets created by a user, whatever their visibility, newest first
+func (m *SnippetModel) ByUser(userID int) ([]*models.Snippet, error) {
+	query := selectSnippets +
+		"WHERE s.expires > ? AND s.user_id = ? " +
+		"ORDER BY s.created DESC, s.id DESC "
+
+	return m.querySnippets(query, time.Now().UTC(), userID)
+}
+
+// Update changes the title, content, language and visibility of a snippet (there is no error if the snippet does not exist)
+// The new version is saved as the next revision of the snippet.
+func (m *SnippetModel) Update(id int, title, content, language, visibility string) error {
+	tx, err := m.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback() // no effect after Commit
+
+	// Concurrent updates can't get the same revision number as the transaction locks the database
+	// when it begins (see connect)
+	var last int
+	err = tx.QueryRow("SELECT COALESCE(MAX(revision), 0) FROM snippet_revisions WHERE snippet_id = ?", id).Scan(&last)
+	if err != nil {
+		return err
+	}
+
+	query := "UPDATE snippets " +
+		"SET title = ?, content = ?, language = ?, visibility = ? " +
+		"WHERE id = ? "
+	if _, err = tx.Exec(query, title, content, language, visibility, id); err != nil {
+		return err
+	}
+	if err = addRevision(tx, id, last+1, time.Now().UTC()); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// Delete removes a snippet (there is no error if the snippet does not exist)
+func (m *SnippetModel) Delete(id int) error {
+	_, err := m.DB.Exec("DELETE FROM snippets WHERE id = ?", id)
+	return err
+}
+
+// SetTags replaces the tags of a snippet (there is no error if the snippet does not exist).
+// The tags must not contain duplicates (see forms.Tags).
+func (m *SnippetModel) SetTags(snippetID int, tags []string) error {
+	tx, err := m.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback() // no effect after Commit
+
+	if _, err = tx.Exec("DELETE FROM snippet_tags WHERE snippet_id = ?", snippetID); err != nil {
+		return err
+	}
+	for _, tag := range tags {
+		// Add the tag if it's new then link it to the snippet (if the snippet exists)
+		if _, err = tx.Exec("INSERT OR IGNORE INTO tags (name) VALUES (?)", tag); err != nil {
+			return err
+		}
+		query := "INSERT " +
+			"INTO snippet_tags (snippet_id, tag_id) " +
+			"SELECT s.id, t.id FROM snippets s, tags t WHERE s.id = ? AND t.name = ? "
+		if _, err = tx.Exec(query, snippetID, tag); err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// Tags returns the tags of a snippet in alphabetical order
+func (m *SnippetModel) Tags(snippetID int) ([]string, error) {
+	query := "SELECT t.name " +
+		"FROM snippet_tags st JOIN tags t ON t.id = st.tag_id " +
+		"WHERE st.snippet_id = ? " +
+		"ORDER BY t.name "
+
+	rows, err := m.DB.Query(query, snippetID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	tags := []string{}
+	for rows.Next() {
+		var tag string
+		if err = rows.Scan(&tag); err != nil {
+			return nil, err
+		}
+		tags = append(tags, tag)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return tags, nil
+}
+
+// ByTag is like Page but only gets snippets with the tag
+func (m *SnippetModel) ByTag(tag string, cursor models.Cursor, limit int) ([]*models.Snippet, error) {
+	filter := "AND s.id IN (SELECT st.snippet_id FROM snippet_tags st JOIN tags t ON t.id = st.tag_id WHERE t.name = ?) "
+	return m.page(filter, []interface{}{tag}, cursor, limit)
+}
+
+// Revisions returns all the revisions of a snippet, latest first
+func (m *SnippetModel) Revisions(snippetID int) ([]*models.Revision, error) {
+	query := "SELECT snippet_id, revision, title, content, created " +
+		"FROM snippet_revisions " +
+		"WHERE snippet_id = ? " +
+		"ORDER BY revision DESC "
+
+	rows, err := m.DB.Query(query, snippetID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	revisions := []*models.Revision{}
+	for rows.Next() {
+		rev := &models.Revision{}
+		if err = rows.Scan(&rev.SnippetID, &rev.Number, &rev.Title, &rev.Content, &rev.Created); err != nil {
+			return nil, err
+		}
+		revisions = append(revisions, rev)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return revisions, nil
+}
+
+// Revision returns one revision of a snippet or nil (and no error) if not found
+func (m *SnippetModel) Revision(snippetID, number int) (*models.Revision, error) {
+	query := "SELECT snippet_id, revision, title, content, created " +
+		"FROM snippet_revisions " +
+		"WHERE snippet_id = ? AND revision = ? "
+
+	rev := &models.Revision{}
+	err := m.DB.QueryRow(query, snippetID, number).Scan(&rev.SnippetID, &rev.Number, &rev.Title, &rev.Content, &rev.Created)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	return rev, nil
+}
+
+// DeleteExpired deletes up to limit snippets that have expired and returns how many were deleted
+func (m *SnippetModel) DeleteExpired(limit int) (int, error) {
+	// SQLite does not allow LIMIT in a DELETE statement (by default) so the IDs are found using a sub-query
+	query := "DELETE " +
+		"FROM snippets " +
+		"WHERE id IN (SELECT id FROM snippets WHERE expires <= ? LIMIT ?) "
+
+	result, err := m.DB.Exec(query, time.Now().UTC(), limit)
+	if err != nil {
+		return 0, err
+	}
+
+	n, err2 := result.RowsAffected()
+	if err2 != nil {
+		return 0, err2
+	}
+
+	return int(n), nil
+}
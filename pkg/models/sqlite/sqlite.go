@@ -0,0 +1,100 @@
+// Package sqlite implements the snippetbox storage backend using an SQLite file database.
+// This allows snippetbox to run as a single self-contained program (no database server).
+package sqlite
+
+import (
+	"database/sql"
+	"embed"
+	"io/fs"
+	"strings"
+
+	"github.com/andrewwphillips/snippetbox/pkg/migrate"
+	"github.com/andrewwphillips/snippetbox/pkg/models"
+	_ "github.com/mattn/go-sqlite3" // registers the "sqlite3" database/sql driver
+)
+
+// init registers this package as the "sqlite" storage backend
+func init() {
+	models.Register("sqlite", open)
+	migrate.Register("sqlite", openMigrator)
+}
+
+// migrationFiles contains the SQL scripts used to create and upgrade the database tables
+//
+//go:embed migrations/*.sql
+var migrationFiles embed.FS
+
+// Make sure the models implement all the methods required by the app
+var (
+	_ models.SnippetStore = (*SnippetModel)(nil)
+	_ models.UserStore    = (*UserModel)(nil)
+)
+
+// connect returns a connection pool for the SQLite database file (dsn)
+func connect(dsn string) (*sql.DB, error) {
+	// Wait (rather than fail with "database is locked") if another connection is writing, and
+	// enforce foreign keys (off by default in SQLite) so deleting a snippet deletes its revisions.
+	// Transactions get the write lock when they begin (BEGIN IMMEDIATE) so that one that reads
+	// then writes (eg Burn) waits for another rather than failing when it comes to write.
+	sep := "?"
+	if strings.Contains(dsn, "?") {
+		sep = "&"
+	}
+	return sql.Open("sqlite3", dsn+sep+"_busy_timeout=5000&_foreign_keys=1&_txlock=immediate")
+}
+
+// newMigrator returns a migrate.Migrator for updating the tables of db to the latest version
+func newMigrator(db *sql.DB) (*migrate.Migrator, error) {
+	dir, err := fs.Sub(migrationFiles, "migrations")
+	if err != nil {
+		return nil, err
+	}
+	migrations, err2 := migrate.Load(dir)
+	if err2 != nil {
+		return nil, err2
+	}
+	return &migrate.Migrator{DB: db, Migrations: migrations}, nil
+}
+
+// openMigrator returns a migrate.Migrator for the SQLite database file (dsn)
+func openMigrator(dsn string) (*migrate.Migrator, error) {
+	db, err := connect(dsn)
+	if err != nil {
+		return nil, err
+	}
+	m, err2 := newMigrator(db)
+	if err2 != nil {
+		db.Close()
+		return nil, err2
+	}
+	return m, nil
+}
+
+// openDB returns a connection pool for the SQLite database file (dsn).  Unlike the
+// other SQL backends any outstanding migrations are applied so that a new database
+// file is ready to use without having to run the "migrate up" command.
+func openDB(dsn string) (*sql.DB, error) {
+	db, err := connect(dsn)
+	if err != nil {
+		return nil, err
+	}
+	m, err2 := newMigrator(db)
+	if err2 != nil {
+		db.Close()
+		return nil, err2
+	}
+	if _, err = m.Up(); err != nil {
+		db.Close()
+		return nil, err
+	}
+	return db, nil
+}
+
+// open is the models.Backend function that creates the snippet and user stores
+func open(dsn string) (models.SnippetStore, models.UserStore, error) {
+	db, err := openDB(dsn)
+	if err != nil {
+		return nil, nil, err
+	}
+	return &SnippetModel{DB: db}, &UserModel{DB: db}, nil
+}
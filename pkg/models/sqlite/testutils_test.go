@@ -0,0 +1,33 @@
+package sqlite
+
+import (
+	"database/sql"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// newTestDB creates a new SQLite database file (in a temp dir) with test data and returns
+// the connection pool and a teardown function.  (Unlike the MySQL tests no database
+// server is needed so these tests are always run.)
+func newTestDB(t *testing.T) (*sql.DB, func()) {
+	db, err := openDB(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Run the setup SQL script to add test data
+	script, err := os.ReadFile("./testdata/setup.sql")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = db.Exec(string(script))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The database file is removed along with the temp dir so teardown just closes it
+	return db, func() {
+		db.Close()
+	}
+}
@@ -0,0 +1,93 @@
+package models
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+// SnippetStore is implemented by each storage backend to provide access to snippets
+type SnippetStore interface {
+	Insert(userID int, title, content, language, visibility string, expires time.Time, password string, burn bool) (int, string, error)
+	Get(id int) (*Snippet, error)
+	GetBySlug(slug string) (*Snippet, error)
+	Unlock(id int, password string) error
+	Burn(id int) (*Snippet, error)
+	Page(cursor Cursor, limit int) ([]*Snippet, error)
+	Search(query string, cursor Cursor, limit int) ([]*Snippet, error)
+	ByUser(userID int) ([]*Snippet, error)
+	Update(id int, title, content, language, visibility string) error
+	Delete(id int) error
+	SetTags(snippetID int, tags []string) error
+	Tags(snippetID int) ([]string, error)
+	ByTag(tag string, cursor Cursor, limit int) ([]*Snippet, error)
+	Revisions(snippetID int) ([]*Revision, error)
+	Revision(snippetID, number int) (*Revision, error)
+	DeleteExpired(limit int) (int, error)
+	Close()
+}
+
+// UserStore is implemented by each storage backend to provide access to users (logins)
+type UserStore interface {
+	Insert(name, email, password string) (int, error)
+	Authenticate(email, password string) (int, string, error)
+	Get(id int) (*User, error)
+	GetByEmail(email string) (*User, error)
+	NewToken(userID int, purpose string, lifetime time.Duration) (string, error)
+	Verify(token string) (int, error)
+	ResetPassword(token, password string) (int, error)
+	UpdateName(id int, name string) error
+	UpdateEmail(id int, email string) error
+	ChangePassword(id int, current, password string) error
+	Close()
+}
+
+// Backend opens the snippet and user stores of a storage backend.  The dsn
+// (data source name) is backend specific - eg a MySQL DSN or a file name.
+type Backend func(dsn string) (SnippetStore, UserStore, error)
+
+var (
+	backendsMu sync.RWMutex
+	backends   = make(map[string]Backend)
+)
+
+// Register makes a storage backend available by name (see Open).  It is
+// intended to be called from the init function of the backend's package.
+// It panics if called twice for the same name or if backend is nil.
+func Register(name string, backend Backend) {
+	backendsMu.Lock()
+	defer backendsMu.Unlock()
+	if backend == nil {
+		panic("models: Register backend is nil")
+	}
+	if _, dup := backends[name]; dup {
+		panic("models: Register called twice for backend " + name)
+	}
+	backends[name] = backend
+}
+
+// Backends returns the sorted names of the registered storage backends
+func Backends() []string {
+	backendsMu.RLock()
+	defer backendsMu.RUnlock()
+	names := make([]string, 0, len(backends))
+	for name := range backends {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Open returns the snippet and user stores of the named storage backend.
+// The backend's package must have been imported (usually with a blank
+// import) so that it has registered itself.
+func Open(name, dsn string) (SnippetStore, UserStore, error) {
+	backendsMu.RLock()
+	backend, ok := backends[name]
+	backendsMu.RUnlock()
+	if !ok {
+		return nil, nil, fmt.Errorf("models: unknown store %q (forgotten import?)", name)
+	}
+	return backend(dsn)
+}
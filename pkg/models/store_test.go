@@ -0,0 +1,34 @@
+package models
+
+import (
+	"errors"
+	"testing"
+)
+
+// TestOpen checks that a registered backend is found by name and that unknown names give an error
+func TestOpen(t *testing.T) {
+	errTest := errors.New("test backend")
+	Register("test", func(dsn string) (SnippetStore, UserStore, error) {
+		if dsn != "test-dsn" {
+			t.Errorf("want dsn %q; got %q", "test-dsn", dsn)
+		}
+		return nil, nil, errTest
+	})
+
+	found := false
+	for _, name := range Backends() {
+		if name == "test" {
+			found = true
+		}
+	}
+	if !found {
+		t.Errorf("want %q in %v", "test", Backends())
+	}
+
+	if _, _, err := Open("test", "test-dsn"); err != errTest {
+		t.Errorf("want %v; got %v", errTest, err)
+	}
+	if _, _, err := Open("no-such-store", ""); err == nil {
+		t.Error("expected error opening unknown store")
+	}
+}
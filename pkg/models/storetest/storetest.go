@@ -0,0 +1,1082 @@
+// Package storetest provides a conformance test suite for snippetbox storage backends.
+// Each backend runs the suite from its own tests, something like:
+//
+//	func TestStore(t *testing.T) {
+//		storetest.Run(t, func(t *testing.T) (models.SnippetStore, models.UserStore) {
+//			return NewSnippetModel(), NewUserModel()
+//		})
+//	}
+//
+// The function passed to Run must return new, empty stores each time it is called (apart
+// from users that do not clash with the email addresses used here, eg alice@example.com).
+// Any cleanup (eg deleting test tables) should be registered with t.Cleanup.
+package storetest
+
+import (
+	"fmt"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/andrewwphillips/snippetbox/pkg/models"
+)
+
+// NewStoresFunc creates the stores that are tested by the conformance suite
+type NewStoresFunc func(t *testing.T) (models.SnippetStore, models.UserStore)
+
+// Run runs all the conformance tests (as sub-tests of t) against the stores created by newStores
+func Run(t *testing.T, newStores NewStoresFunc) {
+	tests := []struct {
+		name string
+		test func(*testing.T, models.SnippetStore, models.UserStore)
+	}{
+		{"SnippetInsertGet", testSnippetInsertGet},
+		{"SnippetNotFound", testSnippetNotFound},
+		{"SnippetExpired", testSnippetExpired},
+		{"SnippetNeverExpires", testSnippetNeverExpires},
+		{"SnippetPage", testSnippetPage},
+		{"SnippetSearch", testSnippetSearch},
+		{"SnippetDeleteExpired", testSnippetDeleteExpired},
+		{"SnippetByUser", testSnippetByUser},
+		{"SnippetUpdate", testSnippetUpdate},
+		{"SnippetDelete", testSnippetDelete},
+		{"SnippetRevisions", testSnippetRevisions},
+		{"SnippetTags", testSnippetTags},
+		{"SnippetVisibility", testSnippetVisibility},
+		{"SnippetBurn", testSnippetBurn},
+		{"SnippetPassword", testSnippetPassword},
+		{"UserInsertGet", testUserInsertGet},
+		{"UserNotFound", testUserNotFound},
+		{"UserDuplicateEmail", testUserDuplicateEmail},
+		{"UserAuthenticate", testUserAuthenticate},
+		{"UserVerify", testUserVerify},
+		{"UserGetByEmail", testUserGetByEmail},
+		{"UserResetPassword", testUserResetPassword},
+		{"UserUpdate", testUserUpdate},
+		{"UserChangePassword", testUserChangePassword},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			snippets, users := newStores(t)
+			tt.test(t, snippets, users)
+		})
+	}
+}
+
+// tolerance allows for differences between the test and store clocks and for stores that only keep whole seconds
+const tolerance = 2 * time.Second
+
+// checkTime reports an error if got is not within tolerance of want
+func checkTime(t *testing.T, field string, got, want time.Time) {
+	t.Helper()
+	if diff := got.Sub(want); diff < -tolerance || diff > tolerance {
+		t.Errorf("%s: want about %v; got %v", field, want.UTC(), got.UTC())
+	}
+}
+
+// mustInsertUser adds a user (to be the author of snippets) failing the test if there is any error
+func mustInsertUser(t *testing.T, users models.UserStore, name string) int {
+	t.Helper()
+	id, err := users.Insert(name, name+"@storetest.example.com", "validPa$$word")
+	if err != nil {
+		t.Fatalf("Insert(%q): %v", name, err)
+	}
+	return id
+}
+
+// days returns the time n days from now, for when a snippet expires (zero days for one that has expired)
+func days(n int) time.Time {
+	return time.Now().AddDate(0, 0, n)
+}
+
+// mustInsertSnippet adds a public snippet (without a language) failing the test if there is any error
+func mustInsertSnippet(t *testing.T, snippets models.SnippetStore, userID int, title, content string, expires time.Time) int {
+	t.Helper()
+	id, _, err := snippets.Insert(userID, title, content, "", models.Public, expires, "", false)
+	if err != nil {
+		t.Fatalf("Insert(%q): %v", title, err)
+	}
+	if id < 1 {
+		t.Fatalf("Insert(%q): want ID > 0; got %d", title, id)
+	}
+	return id
+}
+
+func testSnippetInsertGet(t *testing.T, snippets models.SnippetStore, users models.UserStore) {
+	author := mustInsertUser(t, users, "author")
+	now := time.Now()
+	id, slug, err := snippets.Insert(author, "An old silent pond", "An old silent pond...\nA frog jumps into the pond,", "haiku", models.Unlisted, days(7), "", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(slug) < 12 {
+		t.Errorf("Slug: want at least 12 characters; got %q", slug)
+	}
+
+	s, err := snippets.Get(id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s == nil {
+		t.Fatalf("snippet %d not found", id)
+	}
+	if s.ID != id {
+		t.Errorf("ID: want %d; got %d", id, s.ID)
+	}
+	if s.Slug != slug {
+		t.Errorf("Slug: want %q; got %q", slug, s.Slug)
+	}
+	if s.Title != "An old silent pond" {
+		t.Errorf("Title: want %q; got %q", "An old silent pond", s.Title)
+	}
+	if s.Content != "An old silent pond...\nA frog jumps into the pond," {
+		t.Errorf("Content: want %q; got %q", "An old silent pond...\nA frog jumps into the pond,", s.Content)
+	}
+	if s.Language != "haiku" {
+		t.Errorf("Language: want %q; got %q", "haiku", s.Language)
+	}
+	if s.Visibility != models.Unlisted {
+		t.Errorf("Visibility: want %q; got %q", models.Unlisted, s.Visibility)
+	}
+	if s.UserID != author || s.Author != "author" {
+		t.Errorf("Author: want %d %q; got %d %q", author, "author", s.UserID, s.Author)
+	}
+	checkTime(t, "Created", s.Created, now)
+	checkTime(t, "Expires", s.Expires, now.AddDate(0, 0, 7))
+
+	// The snippet can also be got using its slug
+	if s2, err := snippets.GetBySlug(slug); err != nil || !reflect.DeepEqual(s2, s) {
+		t.Errorf("GetBySlug(%q): want %+v; got %+v, %v", slug, s, s2, err)
+	}
+
+	// A second snippet must get a different ID and slug
+	id2, slug2, err := snippets.Insert(author, "Second", "Second content", "", models.Public, days(1), "", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if id2 == id || slug2 == slug {
+		t.Errorf("want new ID and slug; got %d %q again", id2, slug2)
+	}
+}
+
+func testSnippetNotFound(t *testing.T, snippets models.SnippetStore, users models.UserStore) {
+	author := mustInsertUser(t, users, "author")
+	id := mustInsertSnippet(t, snippets, author, "Title", "Content", days(1))
+
+	for _, notFound := range []int{-1, 0, id + 1000} {
+		s, err := snippets.Get(notFound)
+		if err != nil {
+			t.Errorf("Get(%d): want nil error; got %v", notFound, err)
+		}
+		if s != nil {
+			t.Errorf("Get(%d): want nil snippet; got %+v", notFound, s)
+		}
+	}
+	for _, notFound := range []string{"", "nonexistent", "' OR 1=1 --"} {
+		if s, err := snippets.GetBySlug(notFound); err != nil || s != nil {
+			t.Errorf("GetBySlug(%q): want nil, nil; got %+v, %v", notFound, s, err)
+		}
+	}
+}
+
+func testSnippetExpired(t *testing.T, snippets models.SnippetStore, users models.UserStore) {
+	author := mustInsertUser(t, users, "author")
+	// A snippet kept for zero days has already expired
+	expired, slug, err := snippets.Insert(author, "Expired", "Expired content", "", models.Public, days(0), "", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	current := mustInsertSnippet(t, snippets, author, "Current", "Current content", days(1))
+
+	if s, err := snippets.Get(expired); err != nil || s != nil {
+		t.Errorf("Get(expired): want nil, nil; got %v, %v", s, err)
+	}
+	if s, err := snippets.GetBySlug(slug); err != nil || s != nil {
+		t.Errorf("GetBySlug(expired): want nil, nil; got %v, %v", s, err)
+	}
+
+	latest, err := snippets.Page(models.Cursor{}, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(latest) != 1 || latest[0].ID != current {
+		t.Errorf("Page: want only snippet %d; got %v", current, ids(latest))
+	}
+}
+
+func testSnippetNeverExpires(t *testing.T, snippets models.SnippetStore, users models.UserStore) {
+	author := mustInsertUser(t, users, "author")
+	id := mustInsertSnippet(t, snippets, author, "Forever", "Content", models.Never)
+	mustInsertSnippet(t, snippets, author, "Expired", "Content", days(0))
+
+	s, err := snippets.Get(id)
+	if err != nil || s == nil || !s.Expires.Equal(models.Never) {
+		t.Fatalf("Get: want snippet expiring %v; got %+v, %v", models.Never, s, err)
+	}
+	if n, err := snippets.DeleteExpired(10); err != nil || n != 1 {
+		t.Errorf("DeleteExpired: want 1; got %d, %v", n, err)
+	}
+	if got, err := snippets.Page(models.Cursor{}, 10); err != nil || !reflect.DeepEqual(ids(got), []int{id}) {
+		t.Errorf("Page: want %v; got %v, %v", []int{id}, ids(got), err)
+	}
+}
+
+func testSnippetPage(t *testing.T, snippets models.SnippetStore, users models.UserStore) {
+	author := mustInsertUser(t, users, "author")
+	// An empty store has no snippets but must not return an error
+	if page, err := snippets.Page(models.Cursor{}, 10); err != nil || len(page) != 0 {
+		t.Fatalf("Page (empty): want no snippets and no error; got %v, %v", ids(page), err)
+	}
+
+	// Add snippets - they may be created in the same second so the ID gives the order
+	const count = 12
+	var newest []int // IDs, newest first
+	for i := 0; i < count; i++ {
+		newest = append([]int{mustInsertSnippet(t, snippets, author, "Title", "Content", days(1))}, newest...)
+	}
+	// cursor returns the position of a snippet
+	cursor := func(s *models.Snippet, newer bool) models.Cursor {
+		return models.Cursor{Created: s.Created, ID: s.ID, Newer: newer}
+	}
+
+	// Go forward (to older snippets) 5 at a time
+	page1, err := snippets.Page(models.Cursor{}, 5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(ids(page1), newest[:5]) {
+		t.Fatalf("Page 1: want %v; got %v", newest[:5], ids(page1))
+	}
+	page2, err := snippets.Page(cursor(page1[4], false), 5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(ids(page2), newest[5:10]) {
+		t.Fatalf("Page 2: want %v; got %v", newest[5:10], ids(page2))
+	}
+	page3, err := snippets.Page(cursor(page2[4], false), 5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(ids(page3), newest[10:]) {
+		t.Fatalf("Page 3: want %v; got %v", newest[10:], ids(page3))
+	}
+
+	// Go back (to newer snippets)
+	if back, err := snippets.Page(cursor(page3[0], true), 5); err != nil || !reflect.DeepEqual(ids(back), newest[5:10]) {
+		t.Errorf("Page back from 3: want %v; got %v, %v", newest[5:10], ids(back), err)
+	}
+	if back, err := snippets.Page(cursor(page2[0], true), 10); err != nil || !reflect.DeepEqual(ids(back), newest[:5]) {
+		t.Errorf("Page back from 2: want %v; got %v, %v", newest[:5], ids(back), err)
+	}
+	if back, err := snippets.Page(cursor(page1[0], true), 5); err != nil || len(back) != 0 {
+		t.Errorf("Page back from 1: want none; got %v, %v", ids(back), err)
+	}
+}
+
+func testSnippetDeleteExpired(t *testing.T, snippets models.SnippetStore, users models.UserStore) {
+	author := mustInsertUser(t, users, "author")
+	// Nothing to delete is not an error
+	if n, err := snippets.DeleteExpired(10); err != nil || n != 0 {
+		t.Fatalf("DeleteExpired (empty): want 0, nil; got %d, %v", n, err)
+	}
+
+	current := mustInsertSnippet(t, snippets, author, "Current", "Current content", days(1))
+	for i := 0; i < 3; i++ {
+		mustInsertSnippet(t, snippets, author, "Expired", "Expired content", days(0))
+	}
+
+	// Expired snippets are deleted in batches (up to the limit)
+	for _, want := range []int{2, 1, 0} {
+		n, err := snippets.DeleteExpired(2)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if n != want {
+			t.Errorf("DeleteExpired: want %d deleted; got %d", want, n)
+		}
+	}
+
+	if s, err := snippets.Get(current); err != nil || s == nil {
+		t.Errorf("Get(current): want snippet %d; got %v, %v", current, s, err)
+	}
+}
+
+func testSnippetSearch(t *testing.T, snippets models.SnippetStore, users models.UserStore) {
+	author := mustInsertUser(t, users, "author")
+	pond := mustInsertSnippet(t, snippets, author, "Frog pond", "An old silent pond, a frog jumps into the pond. Haiku", days(1))
+	blossom := mustInsertSnippet(t, snippets, author, "Cherry blossoms", "Cherry blossoms fall in the spring. Haiku", days(1))
+	moon := mustInsertSnippet(t, snippets, author, "Autumn moon", "The autumn moonlight; a worm digs into the chestnut. Haiku", days(1))
+	proverbs := mustInsertSnippet(t, snippets, author, "Go proverbs", "Clear is better than clever. Don't panic.", days(1))
+	mustInsertSnippet(t, snippets, author, "Expired frog", "Expired haiku", days(0))
+
+	tests := []struct {
+		query string
+		want  []int
+	}{
+		{"frog", []int{pond}},
+		{"FROG Pond", []int{pond}},
+		{"blossoms", []int{blossom}}, // title
+		{"spring", []int{blossom}},   // content
+		{"moon", []int{moon}},
+		{"cherry frog", []int{}}, // all words must match
+		{"haiku", []int{moon, blossom, pond}},
+		{"go", []int{proverbs}}, // short words must be found too (eg languages)
+		{"Go clever", []int{proverbs}},
+		{"go frog", []int{}},
+		{"frogs", []int{}},                  // words are not stemmed
+		{"the", []int{moon, blossom, pond}}, // nor are stopwords ignored
+		{"in", []int{blossom}},              // whole words only (not "into")
+		{"", []int{}},
+		{"!!!", []int{}},
+	}
+	for _, tt := range tests {
+		got, err := snippets.Search(tt.query, models.Cursor{}, 10)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(ids(got), tt.want) {
+			t.Errorf("Search(%q): want %v; got %v", tt.query, tt.want, ids(got))
+		}
+	}
+
+	// Results are paged the same as Page
+	cursor := func(s *models.Snippet, newer bool) models.Cursor {
+		return models.Cursor{Created: s.Created, ID: s.ID, Newer: newer}
+	}
+	page1, err := snippets.Search("haiku", models.Cursor{}, 2)
+	if err != nil || !reflect.DeepEqual(ids(page1), []int{moon, blossom}) {
+		t.Fatalf("Search page 1: want %v; got %v, %v", []int{moon, blossom}, ids(page1), err)
+	}
+	page2, err := snippets.Search("haiku", cursor(page1[1], false), 2)
+	if err != nil || !reflect.DeepEqual(ids(page2), []int{pond}) {
+		t.Fatalf("Search page 2: want %v; got %v, %v", []int{pond}, ids(page2), err)
+	}
+	if back, err := snippets.Search("haiku", cursor(page2[0], true), 1); err != nil || !reflect.DeepEqual(ids(back), []int{blossom}) {
+		t.Errorf("Search back: want %v; got %v, %v", []int{blossom}, ids(back), err)
+	}
+
+	// Updated snippets are found using the new text
+	if err = snippets.Update(moon, "Autumn moon", "Harvest moon over the pond", "", models.Public); err != nil {
+		t.Fatal(err)
+	}
+	if got, err := snippets.Search("pond", models.Cursor{}, 10); err != nil || !reflect.DeepEqual(ids(got), []int{moon, pond}) {
+		t.Errorf("Search after update: want %v; got %v, %v", []int{moon, pond}, ids(got), err)
+	}
+}
+
+func testSnippetByUser(t *testing.T, snippets models.SnippetStore, users models.UserStore) {
+	author := mustInsertUser(t, users, "author")
+	other := mustInsertUser(t, users, "other")
+
+	// A user with no snippets is not an error
+	if mine, err := snippets.ByUser(author); err != nil || len(mine) != 0 {
+		t.Fatalf("ByUser (none): want no snippets and no error; got %v, %v", ids(mine), err)
+	}
+
+	first := mustInsertSnippet(t, snippets, author, "First", "Content", days(1))
+	mustInsertSnippet(t, snippets, other, "Other", "Content", days(1))
+	mustInsertSnippet(t, snippets, author, "Expired", "Content", days(0))
+	second := mustInsertSnippet(t, snippets, author, "Second", "Content", days(1))
+
+	// Only the user's own unexpired snippets are returned (newest first)
+	mine, err := snippets.ByUser(author)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(mine) != 2 || mine[0].ID != second || mine[1].ID != first {
+		t.Errorf("ByUser: want %v; got %v", []int{second, first}, ids(mine))
+	}
+	for _, s := range mine {
+		if s.UserID != author || s.Author != "author" {
+			t.Errorf("Author: want %d %q; got %d %q", author, "author", s.UserID, s.Author)
+		}
+	}
+}
+
+func testSnippetUpdate(t *testing.T, snippets models.SnippetStore, users models.UserStore) {
+	author := mustInsertUser(t, users, "author")
+	id := mustInsertSnippet(t, snippets, author, "Title", "Content", days(1))
+	other := mustInsertSnippet(t, snippets, author, "Other", "Other content", days(1))
+
+	if err := snippets.Update(id, "New title", "New content", "sql", models.Private); err != nil {
+		t.Fatal(err)
+	}
+	s, err := snippets.Get(id)
+	if err != nil || s == nil {
+		t.Fatalf("Get(%d): want snippet; got %v, %v", id, s, err)
+	}
+	if s.Title != "New title" || s.Content != "New content" || s.Language != "sql" || s.Visibility != models.Private ||
+		s.UserID != author {
+		t.Errorf("want %q %q %q %q %d; got %q %q %q %q %d", "New title", "New content", "sql", models.Private, author,
+			s.Title, s.Content, s.Language, s.Visibility, s.UserID)
+	}
+
+	// Other snippets are unchanged
+	if s, err := snippets.Get(other); err != nil || s == nil || s.Title != "Other" {
+		t.Errorf("Get(other): want title %q; got %v, %v", "Other", s, err)
+	}
+
+	// Updating a snippet that does not exist is not an error
+	if err := snippets.Update(id+1000, "Title", "Content", "", models.Public); err != nil {
+		t.Errorf("Update (not found): want nil error; got %v", err)
+	}
+}
+
+func testSnippetDelete(t *testing.T, snippets models.SnippetStore, users models.UserStore) {
+	author := mustInsertUser(t, users, "author")
+	id := mustInsertSnippet(t, snippets, author, "Title", "Content", days(1))
+	other := mustInsertSnippet(t, snippets, author, "Other", "Other content", days(1))
+
+	if err := snippets.Delete(id); err != nil {
+		t.Fatal(err)
+	}
+	if s, err := snippets.Get(id); err != nil || s != nil {
+		t.Errorf("Get(deleted): want nil, nil; got %v, %v", s, err)
+	}
+	if s, err := snippets.Get(other); err != nil || s == nil {
+		t.Errorf("Get(other): want snippet; got %v, %v", s, err)
+	}
+
+	// Deleting a snippet that does not exist is not an error
+	if err := snippets.Delete(id); err != nil {
+		t.Errorf("Delete (not found): want nil error; got %v", err)
+	}
+}
+
+func testSnippetRevisions(t *testing.T, snippets models.SnippetStore, users models.UserStore) {
+	author := mustInsertUser(t, users, "author")
+	id := mustInsertSnippet(t, snippets, author, "Title 1", "Content 1", days(1))
+	other := mustInsertSnippet(t, snippets, author, "Other", "Other content", days(1))
+
+	// A new snippet has one revision
+	revisions, err := snippets.Revisions(id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(revisions) != 1 {
+		t.Fatalf("Revisions(new): want 1 revision; got %d", len(revisions))
+	}
+
+	for _, n := range []string{"2", "3"} {
+		if err = snippets.Update(id, "Title "+n, "Content "+n, "", models.Public); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Revisions are returned latest first
+	revisions, err = snippets.Revisions(id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(revisions) != 3 {
+		t.Fatalf("Revisions: want 3 revisions; got %d", len(revisions))
+	}
+	for i, rev := range revisions {
+		want := 3 - i
+		if rev.SnippetID != id || rev.Number != want || rev.Title != fmt.Sprintf("Title %d", want) ||
+			rev.Content != fmt.Sprintf("Content %d", want) {
+			t.Errorf("revision %d: got %+v", want, rev)
+		}
+		checkTime(t, "Created", rev.Created, time.Now())
+	}
+
+	// Get a single revision
+	rev, err := snippets.Revision(id, 2)
+	if err != nil || rev == nil {
+		t.Fatalf("Revision(2): want revision; got %v, %v", rev, err)
+	}
+	if rev.Number != 2 || rev.Title != "Title 2" || rev.Content != "Content 2" {
+		t.Errorf("Revision(2): got %+v", rev)
+	}
+	for _, number := range []int{0, 4} {
+		if rev, err := snippets.Revision(id, number); err != nil || rev != nil {
+			t.Errorf("Revision(%d): want nil, nil; got %v, %v", number, rev, err)
+		}
+	}
+
+	// Other snippets are unaffected
+	if revisions, err := snippets.Revisions(other); err != nil || len(revisions) != 1 {
+		t.Errorf("Revisions(other): want 1 revision; got %d, %v", len(revisions), err)
+	}
+
+	// Deleting a snippet deletes its revisions
+	if err = snippets.Delete(id); err != nil {
+		t.Fatal(err)
+	}
+	if revisions, err := snippets.Revisions(id); err != nil || len(revisions) != 0 {
+		t.Errorf("Revisions(deleted): want none; got %d, %v", len(revisions), err)
+	}
+}
+
+func testSnippetTags(t *testing.T, snippets models.SnippetStore, users models.UserStore) {
+	author := mustInsertUser(t, users, "author")
+	first := mustInsertSnippet(t, snippets, author, "First", "Content", days(1))
+	second := mustInsertSnippet(t, snippets, author, "Second", "Content", days(1))
+	expired := mustInsertSnippet(t, snippets, author, "Expired", "Content", days(0))
+
+	// A new snippet has no tags
+	if tags, err := snippets.Tags(first); err != nil || len(tags) != 0 {
+		t.Fatalf("Tags(new): want none; got %v, %v", tags, err)
+	}
+
+	for id, tags := range map[int][]string{
+		first:   {"sql", "bash"},
+		second:  {"k8s", "sql"},
+		expired: {"sql"},
+	} {
+		if err := snippets.SetTags(id, tags); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Tags are returned in alphabetical order
+	if tags, err := snippets.Tags(first); err != nil || !reflect.DeepEqual(tags, []string{"bash", "sql"}) {
+		t.Errorf("Tags(first): want %v; got %v, %v", []string{"bash", "sql"}, tags, err)
+	}
+
+	tests := []struct {
+		tag  string
+		want []int
+	}{
+		{"sql", []int{second, first}}, // not expired
+		{"bash", []int{first}},
+		{"k8s", []int{second}},
+		{"go", []int{}},
+	}
+	for _, tt := range tests {
+		got, err := snippets.ByTag(tt.tag, models.Cursor{}, 10)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(ids(got), tt.want) {
+			t.Errorf("ByTag(%q): want %v; got %v", tt.tag, tt.want, ids(got))
+		}
+	}
+
+	// Results are paged the same as Page
+	page, err := snippets.ByTag("sql", models.Cursor{Created: time.Now().UTC().Add(time.Hour), ID: second + 1}, 1)
+	if err != nil || !reflect.DeepEqual(ids(page), []int{second}) {
+		t.Errorf("ByTag page 1: want %v; got %v, %v", []int{second}, ids(page), err)
+	}
+
+	// Replacing the tags
+	if err = snippets.SetTags(first, []string{"go"}); err != nil {
+		t.Fatal(err)
+	}
+	if tags, err := snippets.Tags(first); err != nil || !reflect.DeepEqual(tags, []string{"go"}) {
+		t.Errorf("Tags(replaced): want %v; got %v, %v", []string{"go"}, tags, err)
+	}
+	if got, err := snippets.ByTag("sql", models.Cursor{}, 10); err != nil || !reflect.DeepEqual(ids(got), []int{second}) {
+		t.Errorf("ByTag(replaced): want %v; got %v, %v", []int{second}, ids(got), err)
+	}
+
+	// Removing all the tags and setting tags of a snippet that does not exist
+	if err = snippets.SetTags(first, nil); err != nil {
+		t.Fatal(err)
+	}
+	if tags, err := snippets.Tags(first); err != nil || len(tags) != 0 {
+		t.Errorf("Tags(removed): want none; got %v, %v", tags, err)
+	}
+	if err = snippets.SetTags(expired+1000, []string{"sql"}); err != nil {
+		t.Errorf("SetTags (not found): want nil error; got %v", err)
+	}
+
+	// Deleting a snippet deletes its tags
+	if err = snippets.Delete(second); err != nil {
+		t.Fatal(err)
+	}
+	if got, err := snippets.ByTag("k8s", models.Cursor{}, 10); err != nil || len(got) != 0 {
+		t.Errorf("ByTag(deleted): want none; got %v, %v", ids(got), err)
+	}
+	if tags, err := snippets.Tags(second); err != nil || len(tags) != 0 {
+		t.Errorf("Tags(deleted): want none; got %v, %v", tags, err)
+	}
+}
+
+func testSnippetVisibility(t *testing.T, snippets models.SnippetStore, users models.UserStore) {
+	author := mustInsertUser(t, users, "author")
+	public := mustInsertSnippet(t, snippets, author, "Public pond", "Content", days(1))
+	var unlisted, private int
+	for _, v := range []struct {
+		id         *int
+		visibility string
+	}{{&unlisted, models.Unlisted}, {&private, models.Private}} {
+		id, _, err := snippets.Insert(author, "Hidden pond", "Content", "", v.visibility, days(1), "", false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err = snippets.SetTags(id, []string{"pond"}); err != nil {
+			t.Fatal(err)
+		}
+		*v.id = id
+	}
+	if err := snippets.SetTags(public, []string{"pond"}); err != nil {
+		t.Fatal(err)
+	}
+
+	// Only public snippets are listed or searched
+	if got, err := snippets.Page(models.Cursor{}, 10); err != nil || !reflect.DeepEqual(ids(got), []int{public}) {
+		t.Errorf("Page: want %v; got %v, %v", []int{public}, ids(got), err)
+	}
+	if got, err := snippets.Search("pond", models.Cursor{}, 10); err != nil || !reflect.DeepEqual(ids(got), []int{public}) {
+		t.Errorf("Search: want %v; got %v, %v", []int{public}, ids(got), err)
+	}
+	if got, err := snippets.ByTag("pond", models.Cursor{}, 10); err != nil || !reflect.DeepEqual(ids(got), []int{public}) {
+		t.Errorf("ByTag: want %v; got %v, %v", []int{public}, ids(got), err)
+	}
+
+	// The owner's list includes them all and any snippet can be got by ID
+	if got, err := snippets.ByUser(author); err != nil || !reflect.DeepEqual(ids(got), []int{private, unlisted, public}) {
+		t.Errorf("ByUser: want %v; got %v, %v", []int{private, unlisted, public}, ids(got), err)
+	}
+	for _, id := range []int{public, unlisted, private} {
+		if s, err := snippets.Get(id); err != nil || s == nil {
+			t.Errorf("Get(%d): want snippet; got %v, %v", id, s, err)
+		}
+	}
+
+	// Making a snippet public lists it
+	if err := snippets.Update(unlisted, "Hidden pond", "Content", "", models.Public); err != nil {
+		t.Fatal(err)
+	}
+	if got, err := snippets.Page(models.Cursor{}, 10); err != nil || !reflect.DeepEqual(ids(got), []int{unlisted, public}) {
+		t.Errorf("Page (updated): want %v; got %v, %v", []int{unlisted, public}, ids(got), err)
+	}
+}
+
+func testSnippetBurn(t *testing.T, snippets models.SnippetStore, users models.UserStore) {
+	author := mustInsertUser(t, users, "author")
+	id, slug, err := snippets.Insert(author, "Secret", "The password is swordfish", "", models.Unlisted, days(1), "", true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = snippets.SetTags(id, []string{"secret"}); err != nil {
+		t.Fatal(err)
+	}
+	public, _, err := snippets.Insert(author, "Public secret", "Content", "", models.Public, days(1), "", true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expired, _, err := snippets.Insert(author, "Expired", "Content", "", models.Public, days(0), "", true)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The snippet can be got (eg by its author) as usual
+	s, err := snippets.GetBySlug(slug)
+	if err != nil || s == nil || !s.BurnAfterReading {
+		t.Fatalf("GetBySlug: want snippet to be burned; got %+v, %v", s, err)
+	}
+
+	// Snippets to be burned are never listed as the list (eg search results) could show the content
+	if got, err := snippets.Page(models.Cursor{}, 10); err != nil || len(got) != 0 {
+		t.Errorf("Page: want none; got %v, %v", ids(got), err)
+	}
+	if got, err := snippets.Search("secret", models.Cursor{}, 10); err != nil || len(got) != 0 {
+		t.Errorf("Search: want none; got %v, %v", ids(got), err)
+	}
+	if got, err := snippets.ByUser(author); err != nil || !reflect.DeepEqual(ids(got), []int{public, id}) {
+		t.Errorf("ByUser: want %v; got %v, %v", []int{public, id}, ids(got), err)
+	}
+
+	// Burning returns the snippet and deletes it
+	burned, err := snippets.Burn(id)
+	if err != nil || !reflect.DeepEqual(burned, s) {
+		t.Fatalf("Burn: want %+v; got %+v, %v", s, burned, err)
+	}
+	if s, err := snippets.Get(id); err != nil || s != nil {
+		t.Errorf("Get(burned): want nil, nil; got %+v, %v", s, err)
+	}
+	if revs, err := snippets.Revisions(id); err != nil || len(revs) != 0 {
+		t.Errorf("Revisions(burned): want none; got %d, %v", len(revs), err)
+	}
+	if tags, err := snippets.Tags(id); err != nil || len(tags) != 0 {
+		t.Errorf("Tags(burned): want none; got %v, %v", tags, err)
+	}
+	for _, notFound := range []int{id, expired, id + 1000} {
+		if s, err := snippets.Burn(notFound); err != nil || s != nil {
+			t.Errorf("Burn(%d): want nil, nil; got %+v, %v", notFound, s, err)
+		}
+	}
+
+	// Only one of many concurrent readers gets the snippet
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	got := 0
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			s, err := snippets.Burn(public)
+			if err != nil {
+				t.Errorf("Burn (concurrent): %v", err)
+			}
+			if s != nil {
+				mu.Lock()
+				got++
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+	if got != 1 {
+		t.Errorf("Burn (concurrent): want 1 reader to get the snippet; got %d", got)
+	}
+}
+
+func testSnippetPassword(t *testing.T, snippets models.SnippetStore, users models.UserStore) {
+	author := mustInsertUser(t, users, "author")
+	id, slug, err := snippets.Insert(author, "Locked pond", "The password is swordfish", "", models.Public, days(1), "open sesame", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	open := mustInsertSnippet(t, snippets, author, "Open pond", "Content", days(1))
+	expired, _, err := snippets.Insert(author, "Expired", "Content", "", models.Public, days(0), "open sesame", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The snippet can be got (eg to show the unlock form) but only says that it's protected
+	s, err := snippets.GetBySlug(slug)
+	if err != nil || s == nil || !s.Protected || s.Listed() {
+		t.Fatalf("GetBySlug: want protected snippet; got %+v, %v", s, err)
+	}
+	if s, err := snippets.Get(open); err != nil || s == nil || s.Protected {
+		t.Errorf("Get(open): want unprotected snippet; got %+v, %v", s, err)
+	}
+
+	// Protected snippets are never listed as the list (eg search results) could show the content
+	if got, err := snippets.Page(models.Cursor{}, 10); err != nil || !reflect.DeepEqual(ids(got), []int{open}) {
+		t.Errorf("Page: want %v; got %v, %v", []int{open}, ids(got), err)
+	}
+	if got, err := snippets.Search("pond", models.Cursor{}, 10); err != nil || !reflect.DeepEqual(ids(got), []int{open}) {
+		t.Errorf("Search: want %v; got %v, %v", []int{open}, ids(got), err)
+	}
+	if got, err := snippets.ByUser(author); err != nil || !reflect.DeepEqual(ids(got), []int{open, id}) {
+		t.Errorf("ByUser: want %v; got %v, %v", []int{open, id}, ids(got), err)
+	}
+
+	tests := []struct {
+		name     string
+		id       int
+		password string
+		want     error
+	}{
+		{"Right password", id, "open sesame", nil},
+		{"Wrong password", id, "open says me", models.ErrInvalidCredentials},
+		{"Empty password", id, "", models.ErrInvalidCredentials},
+		{"Not protected", open, "anything", nil},
+		{"Expired", expired, "open sesame", models.ErrInvalidCredentials},
+		{"Not found", id + 1000, "open sesame", models.ErrInvalidCredentials},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := snippets.Unlock(tt.id, tt.password); err != tt.want {
+				t.Errorf("Unlock: want %v; got %v", tt.want, err)
+			}
+		})
+	}
+}
+
+func testUserInsertGet(t *testing.T, _ models.SnippetStore, users models.UserStore) {
+	now := time.Now()
+	id, err := users.Insert("Bob", "bob@storetest.example.com", "validPa$$word")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	user, err := users.Get(id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if user == nil {
+		t.Fatalf("user %d not found", id)
+	}
+	if user.ID != id || user.Name != "Bob" || user.Email != "bob@storetest.example.com" {
+		t.Errorf("want %d %q %q; got %d %q %q", id, "Bob", "bob@storetest.example.com", user.ID, user.Name, user.Email)
+	}
+	if user.Verified {
+		t.Errorf("Verified: want new user not verified")
+	}
+	checkTime(t, "Created", user.Created, now)
+}
+
+func testUserNotFound(t *testing.T, _ models.SnippetStore, users models.UserStore) {
+	id, err := users.Insert("Bob", "bob@storetest.example.com", "validPa$$word")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, notFound := range []int{-1, 0, id + 1000} {
+		user, err := users.Get(notFound)
+		if err != nil {
+			t.Errorf("Get(%d): want nil error; got %v", notFound, err)
+		}
+		if user != nil {
+			t.Errorf("Get(%d): want nil user; got %+v", notFound, user)
+		}
+	}
+}
+
+func testUserDuplicateEmail(t *testing.T, _ models.SnippetStore, users models.UserStore) {
+	if _, err := users.Insert("Bob", "bob@storetest.example.com", "validPa$$word"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := users.Insert("Robert", "bob@storetest.example.com", "otherPa$$word"); err != models.ErrDuplicateEmail {
+		t.Errorf("want %v; got %v", models.ErrDuplicateEmail, err)
+	}
+}
+
+func testUserAuthenticate(t *testing.T, _ models.SnippetStore, users models.UserStore) {
+	id, err := users.Insert("Bob", "bob@storetest.example.com", "validPa$$word")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	gotID, name, err := users.Authenticate("bob@storetest.example.com", "validPa$$word")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if gotID != id || name != "Bob" {
+		t.Errorf("want %d %q; got %d %q", id, "Bob", gotID, name)
+	}
+
+	tests := []struct {
+		name, email, password string
+	}{
+		{"Wrong password", "bob@storetest.example.com", "wrongPa$$word"},
+		{"Empty password", "bob@storetest.example.com", ""},
+		{"Unknown email", "nobody@storetest.example.com", "validPa$$word"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, _, err := users.Authenticate(tt.email, tt.password); err != models.ErrInvalidCredentials {
+				t.Errorf("want %v; got %v", models.ErrInvalidCredentials, err)
+			}
+		})
+	}
+}
+
+func testUserVerify(t *testing.T, _ models.SnippetStore, users models.UserStore) {
+	id := mustInsertUser(t, users, "bob")
+	other := mustInsertUser(t, users, "carol")
+	first, err := users.NewToken(id, models.TokenVerify, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := users.NewToken(id, models.TokenVerify, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if first == second || len(first) < 40 {
+		t.Errorf("NewToken: want different random tokens; got %q and %q", first, second)
+	}
+	expired, err := users.NewToken(other, models.TokenVerify, -time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	otherPurpose, err := users.NewToken(other, "other", time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Invalid tokens are rejected (and don't verify the user)
+	for _, token := range []string{"", "nonsense", expired, otherPurpose, first + "x"} {
+		if got, err := users.Verify(token); err != models.ErrInvalidToken {
+			t.Errorf("Verify(%q): want %v; got %d, %v", token, models.ErrInvalidToken, got, err)
+		}
+	}
+	if user, err := users.Get(other); err != nil || user.Verified {
+		t.Errorf("Get(other): want not verified; got %+v, %v", user, err)
+	}
+
+	// Any of the user's tokens verifies them but then all their tokens are used up
+	if got, err := users.Verify(second); err != nil || got != id {
+		t.Fatalf("Verify: want %d; got %d, %v", id, got, err)
+	}
+	if user, err := users.Get(id); err != nil || !user.Verified {
+		t.Errorf("Get: want verified; got %+v, %v", user, err)
+	}
+	for _, token := range []string{first, second} {
+		if got, err := users.Verify(token); err != models.ErrInvalidToken {
+			t.Errorf("Verify(%q) again: want %v; got %d, %v", token, models.ErrInvalidToken, got, err)
+		}
+	}
+}
+
+// testUserGetByEmail checks users can be found by their email address (but not the password hash)
+func testUserGetByEmail(t *testing.T, _ models.SnippetStore, users models.UserStore) {
+	id := mustInsertUser(t, users, "bob")
+	mustInsertUser(t, users, "carol")
+
+	user, err := users.GetByEmail("bob@storetest.example.com")
+	if err != nil || user == nil {
+		t.Fatalf("GetByEmail: want user; got %v, %v", user, err)
+	}
+	if user.ID != id || user.Name != "bob" || user.HashedPassword != nil {
+		t.Errorf("GetByEmail: want user %d (bob) with no password hash; got %+v", id, user)
+	}
+	for _, email := range []string{"", "dave@storetest.example.com", "BOB@storetest.example"} {
+		if user, err := users.GetByEmail(email); err != nil || user != nil {
+			t.Errorf("GetByEmail(%q): want nil, nil; got %+v, %v", email, user, err)
+		}
+	}
+}
+
+// testUserResetPassword checks a reset token changes the password (once) and ends the user's sessions
+func testUserResetPassword(t *testing.T, _ models.SnippetStore, users models.UserStore) {
+	id := mustInsertUser(t, users, "bob")
+	before, err := users.Get(id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	verify, err := users.NewToken(id, models.TokenVerify, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	token, err := users.NewToken(id, models.TokenReset, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Only an unexpired reset token can be used
+	expired, err := users.NewToken(id, models.TokenReset, -time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tok := range []string{"nonsense", expired, verify} {
+		if got, err := users.ResetPassword(tok, "newPa$$word1"); err != models.ErrInvalidToken {
+			t.Errorf("ResetPassword(%q): want %v; got %d, %v", tok, models.ErrInvalidToken, got, err)
+		}
+	}
+
+	if got, err := users.ResetPassword(token, "newPa$$word1"); err != nil || got != id {
+		t.Fatalf("ResetPassword: want %d; got %d, %v", id, got, err)
+	}
+	if _, _, err := users.Authenticate("bob@storetest.example.com", "validPa$$word"); err != models.ErrInvalidCredentials {
+		t.Errorf("Authenticate old password: want %v; got %v", models.ErrInvalidCredentials, err)
+	}
+	if got, _, err := users.Authenticate("bob@storetest.example.com", "newPa$$word1"); err != nil || got != id {
+		t.Errorf("Authenticate new password: want %d; got %d, %v", id, got, err)
+	}
+	after, err := users.Get(id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !after.Verified || after.SessionVersion == before.SessionVersion {
+		t.Errorf("Get: want verified and session version changed from %d; got %+v", before.SessionVersion, after)
+	}
+
+	// The token can't be used again
+	if got, err := users.ResetPassword(token, "otherPa$$word"); err != models.ErrInvalidToken {
+		t.Errorf("ResetPassword again: want %v; got %d, %v", models.ErrInvalidToken, got, err)
+	}
+}
+
+// testUserUpdate checks a user's name and email address can be changed (to one that is not in use) and that
+// a new address must be verified
+func testUserUpdate(t *testing.T, _ models.SnippetStore, users models.UserStore) {
+	id := mustInsertUser(t, users, "bob")
+	mustInsertUser(t, users, "carol")
+	token, err := users.NewToken(id, models.TokenVerify, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = users.Verify(token); err != nil {
+		t.Fatal(err)
+	}
+
+	if err = users.UpdateName(id, "Robert"); err != nil {
+		t.Fatalf("UpdateName: %v", err)
+	}
+	if err = users.UpdateEmail(id, "carol@storetest.example.com"); err != models.ErrDuplicateEmail {
+		t.Errorf("UpdateEmail(carol's): want %v; got %v", models.ErrDuplicateEmail, err)
+	}
+	if user, err := users.Get(id); err != nil || user.Email != "bob@storetest.example.com" || !user.Verified {
+		t.Errorf("Get after duplicate: want email unchanged and verified; got %+v, %v", user, err)
+	}
+
+	// The new address must be verified
+	if err = users.UpdateEmail(id, "robert@storetest.example.com"); err != nil {
+		t.Fatalf("UpdateEmail: %v", err)
+	}
+	user, err := users.Get(id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if user.Name != "Robert" || user.Email != "robert@storetest.example.com" || user.Verified {
+		t.Errorf("Get: want Robert (robert@storetest.example.com) not verified; got %+v", user)
+	}
+	if got, _, err := users.Authenticate("robert@storetest.example.com", "validPa$$word"); err != nil || got != id {
+		t.Errorf("Authenticate new email: want %d; got %d, %v", id, got, err)
+	}
+	if err = users.UpdateEmail(id, "robert@storetest.example.com"); err != nil {
+		t.Errorf("UpdateEmail unchanged: want no error; got %v", err)
+	}
+
+	// Tokens emailed to the old address can't be used once the address has changed
+	verify, err := users.NewToken(id, models.TokenVerify, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	reset, err := users.NewToken(id, models.TokenReset, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = users.UpdateEmail(id, "bobby@storetest.example.com"); err != nil {
+		t.Fatalf("UpdateEmail: %v", err)
+	}
+	if got, err := users.Verify(verify); err != models.ErrInvalidToken {
+		t.Errorf("Verify with old token: want %v; got %d, %v", models.ErrInvalidToken, got, err)
+	}
+	if got, err := users.ResetPassword(reset, "newPa$$word1"); err != models.ErrInvalidToken {
+		t.Errorf("ResetPassword with old token: want %v; got %d, %v", models.ErrInvalidToken, got, err)
+	}
+	if user, err := users.Get(id); err != nil || user.Verified {
+		t.Errorf("Get after old tokens: want not verified; got %+v, %v", user, err)
+	}
+}
+
+// testUserChangePassword checks the password can only be changed given the current one and that it ends the user's sessions
+func testUserChangePassword(t *testing.T, _ models.SnippetStore, users models.UserStore) {
+	id := mustInsertUser(t, users, "bob")
+	before, err := users.Get(id)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err = users.ChangePassword(id, "wrongPa$$word", "newPa$$word1"); err != models.ErrInvalidCredentials {
+		t.Errorf("ChangePassword(wrong): want %v; got %v", models.ErrInvalidCredentials, err)
+	}
+	if err = users.ChangePassword(id+1000, "validPa$$word", "newPa$$word1"); err != models.ErrInvalidCredentials {
+		t.Errorf("ChangePassword(not found): want %v; got %v", models.ErrInvalidCredentials, err)
+	}
+	if after, err := users.Get(id); err != nil || after.SessionVersion != before.SessionVersion {
+		t.Errorf("Get after failure: want session version %d; got %+v, %v", before.SessionVersion, after, err)
+	}
+
+	if err = users.ChangePassword(id, "validPa$$word", "newPa$$word1"); err != nil {
+		t.Fatalf("ChangePassword: %v", err)
+	}
+	if _, _, err := users.Authenticate("bob@storetest.example.com", "validPa$$word"); err != models.ErrInvalidCredentials {
+		t.Errorf("Authenticate old password: want %v; got %v", models.ErrInvalidCredentials, err)
+	}
+	if got, _, err := users.Authenticate("bob@storetest.example.com", "newPa$$word1"); err != nil || got != id {
+		t.Errorf("Authenticate new password: want %d; got %d, %v", id, got, err)
+	}
+	if after, err := users.Get(id); err != nil || after.SessionVersion == before.SessionVersion {
+		t.Errorf("Get: want session version changed from %d; got %+v, %v", before.SessionVersion, after, err)
+	}
+}
+
+// ids returns the IDs of snippets (used to make error messages more readable)
+func ids(snippets []*models.Snippet) []int {
+	r := make([]int, 0, len(snippets))
+	for _, s := range snippets {
+		r = append(r, s.ID)
+	}
+	return r
+}